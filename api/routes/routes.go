@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"fmt"
 	"net/http"
 	"os"
 	"time"
@@ -13,6 +14,7 @@ import (
 	"github.com/thelostleo/CTF-backend/database"
 	"github.com/thelostleo/CTF-backend/middleware"
 	"github.com/thelostleo/CTF-backend/models"
+	"github.com/thelostleo/CTF-backend/utils"
 )
 
 // NewRouter creates and configures the HTTP router
@@ -77,6 +79,22 @@ func setupBasicRoutes(router *gin.Engine) {
 			"port":   os.Getenv("PORT"),
 		})
 	})
+
+	// Public keys for verifying access tokens
+	router.GET("/.well-known/jwks.json", func(c *gin.Context) {
+		ring, err := utils.GetKeyRing()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Signing keys unavailable",
+			})
+			return
+		}
+		// Keys are published one cache period before they sign
+		c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(utils.GetJWKSCacheTTL().Seconds())))
+		c.JSON(http.StatusOK, gin.H{
+			"keys": ring.JWKS(),
+		})
+	})
 }
 
 // setupAPIRoutes configures the CTF API routes
@@ -85,18 +103,38 @@ func setupAPIRoutes(router *gin.Engine) {
 	userController := &controllers.UserController{}
 	challengeController := &controllers.ChallengeController{}
 	adminController := &controllers.AdminController{}
+	teamController := &controllers.TeamController{}
+	eventController := &controllers.EventController{}
+	sessionController := &controllers.SessionController{}
+	mfaController := &controllers.MFAController{}
+	accountController := &controllers.AccountController{}
+	oidcController := &controllers.OIDCController{}
+	apiTokenController := &controllers.APITokenController{}
 
 	// API v1 group
 	api := router.Group("/api/v1")
 
 	// Public routes (no authentication required)
 	public := api.Group("/")
+	public.Use(middleware.OptionalAuthMiddleware()) // Lets admins bypass the event window
 	{
-		// Public challenge viewing (without flags)
-		public.GET("/challenges", challengeController.GetAllChallenges)
-		public.GET("/challenges/:id", challengeController.GetChallengeByID)
+		// Event time window
+		public.GET("/event", eventController.GetEvent)
+		public.GET("/announcements", eventController.GetAnnouncements)
 
-		// Public leaderboard
+		// Public challenge viewing (without flags), hidden until the event starts
+		challenges := public.Group("/")
+		challenges.Use(middleware.EventStartedMiddleware())
+		{
+			challenges.GET("/challenges", challengeController.GetAllChallenges)
+			challenges.GET("/challenges/graph", challengeController.GetChallengeGraph)
+			challenges.GET("/challenges/:id", challengeController.GetChallengeByID)
+		}
+
+		// Challenge file downloads, authorized by the signed URL
+		public.GET("/files/:id", challengeController.DownloadFile)
+
+		// Public leaderboard (frozen for non-admins after the freeze time)
 		public.GET("/leaderboard", userController.GetLeaderboard)
 	}
 
@@ -106,6 +144,18 @@ func setupAPIRoutes(router *gin.Engine) {
 	{
 		auth.POST("/register", userController.Register)
 		auth.POST("/login", userController.Login)
+		auth.POST("/login/2fa", mfaController.VerifyLogin)
+		auth.POST("/verify-email", accountController.VerifyEmail)
+		auth.POST("/forgot-password", accountController.ForgotPassword)
+		auth.POST("/reset-password", accountController.ResetPassword)
+
+		// Token refresh (rotates the refresh token)
+		auth.POST("/refresh-token", userController.RefreshToken)
+
+		// OpenID Connect login (authorization code + PKCE)
+		auth.GET("/auth/oidc/providers", oidcController.GetProviders)
+		auth.GET("/auth/oidc/:provider/login", oidcController.StartLogin)
+		auth.POST("/auth/oidc/:provider/callback", oidcController.Callback)
 	}
 
 	// Protected routes (authentication required)
@@ -114,13 +164,50 @@ func setupAPIRoutes(router *gin.Engine) {
 	{
 		// User profile
 		protected.GET("/profile", userController.GetProfile)
+		protected.PUT("/profile", userController.UpdateProfile)
+		protected.PUT("/profile/password", userController.ChangePassword)
+		protected.DELETE("/profile", userController.DeleteAccount)
+
+		protected.POST("/profile/verify-email/resend", accountController.ResendVerification)
+
+		// Personal API tokens
+		protected.GET("/profile/tokens", apiTokenController.GetTokens)
+		protected.POST("/profile/tokens", apiTokenController.CreateToken)
+		protected.DELETE("/profile/tokens/:id", apiTokenController.RevokeToken)
+
+		// Two-factor authentication
+		protected.POST("/profile/2fa/enroll", mfaController.Enroll)
+		protected.POST("/profile/2fa/confirm", mfaController.Confirm)
+		protected.POST("/profile/2fa/disable", mfaController.Disable)
+		protected.POST("/profile/2fa/recovery-codes", mfaController.RegenerateRecoveryCodes)
+
+		// Session management
+		protected.POST("/logout", sessionController.Logout)
+		protected.GET("/sessions", sessionController.GetSessions)
+		protected.DELETE("/sessions", sessionController.RevokeAllSessions)
+		protected.DELETE("/sessions/:id", sessionController.RevokeSession)
 
-		// Token refresh
-		protected.POST("/refresh-token", userController.RefreshToken)
+		// Team management
+		protected.GET("/teams/me", teamController.GetMyTeam)
+		protected.POST("/teams", teamController.CreateTeam)
+		protected.POST("/teams/join", teamController.JoinTeam)
+		protected.POST("/teams/leave", teamController.LeaveTeam)
+		protected.POST("/teams/invite-code", teamController.RegenerateInviteCode)
+		protected.DELETE("/teams/members/:user_id", teamController.KickMember)
+
+		// Hints (content hidden until unlocked)
+		hints := protected.Group("/")
+		hints.Use(middleware.EventStartedMiddleware())
+		{
+			hints.GET("/challenges/:id/hints", challengeController.GetChallengeHints)
+			hints.POST("/challenges/:id/hints/:hint_id/unlock", challengeController.UnlockHint)
+		}
 
 		// Flag submission with rate limiting
 		flagSubmission := protected.Group("/")
 		flagSubmission.Use(middleware.FlagSubmissionRateLimit())
+		flagSubmission.Use(middleware.EventRunningMiddleware())
+		flagSubmission.Use(middleware.EmailVerifiedMiddleware())
 		{
 			flagSubmission.POST("/challenges/:id/submit", challengeController.SubmitFlag)
 		}
@@ -129,15 +216,97 @@ func setupAPIRoutes(router *gin.Engine) {
 	admin.Use(middleware.AuthMiddleware())
 	admin.Use(middleware.AdminMiddleware())
 	{
-		// Challenge management
-		admin.POST("/challenges", adminController.CreateChallenge)
-		admin.PUT("/challenges/:id", adminController.UpdateChallenge)
-		admin.DELETE("/challenges/:id", adminController.DeleteChallenge)
+		// Admin dashboard
+		admin.GET("/dashboard", middleware.RequirePermission(models.PermDashboardView), adminController.GetDashboard)
+
+		// Challenge, flag and hint management (authors are limited to their own challenges)
+		challenges := admin.Group("/")
+		challenges.Use(middleware.RequirePermission(models.PermChallengesWrite))
+		{
+			challenges.POST("/challenges", adminController.CreateChallenge)
+			challenges.PUT("/challenges/:id", adminController.UpdateChallenge)
+			challenges.DELETE("/challenges/:id", adminController.DeleteChallenge)
+
+			// Bundle import and export cover every challenge
+			challenges.POST("/challenges/import", middleware.RequirePermission(models.PermChallengesWriteAll), adminController.ImportChallenges)
+			challenges.GET("/challenges/export", middleware.RequirePermission(models.PermChallengesWriteAll), adminController.ExportChallenges)
+
+			// Unlock graph
+			challenges.GET("/challenges/graph", adminController.GetChallengeGraph)
+			challenges.PUT("/challenges/:id/prerequisites", adminController.SetChallengePrerequisites)
+			challenges.PUT("/challenges/:id/schedule", adminController.SetChallengeSchedule)
+
+			// File attachments
+			challenges.GET("/challenges/:id/files", adminController.GetChallengeFiles)
+			challenges.POST("/challenges/:id/files", adminController.UploadChallengeFiles)
+			challenges.GET("/challenges/:id/files/:file_id", adminController.DownloadChallengeFile)
+			challenges.DELETE("/challenges/:id/files/:file_id", adminController.DeleteChallengeFile)
+
+			// Flag management
+			challenges.GET("/challenges/:id/flags", adminController.GetChallengeFlags)
+			challenges.POST("/challenges/:id/flags", adminController.CreateFlag)
+			challenges.GET("/challenges/:id/flags/derive", adminController.DeriveDynamicFlag)
+			challenges.DELETE("/flags/:id", adminController.DeleteFlag)
+
+			// Hint management
+			challenges.GET("/challenges/:id/hints", adminController.GetChallengeHints)
+			challenges.POST("/challenges/:id/hints", adminController.CreateHint)
+			challenges.PUT("/hints/:id", adminController.UpdateHint)
+			challenges.DELETE("/hints/:id", adminController.DeleteHint)
+		}
 
 		// User management
-		admin.GET("/users", adminController.GetAllUsers)
+		admin.GET("/users", middleware.RequirePermission(models.PermUsersView), adminController.GetAllUsers)
+		admin.GET("/cheat-incidents", middleware.RequirePermission(models.PermCheatView), adminController.GetCheatIncidents)
+		admin.GET("/locked-accounts", middleware.RequirePermission(models.PermUsersView), adminController.GetLockedAccounts)
+		admin.GET("/login-attempts", middleware.RequirePermission(models.PermUsersView), adminController.GetLoginAttempts)
+		moderation := admin.Group("/users")
+		moderation.Use(middleware.RequirePermission(models.PermUsersManage))
+		{
+			moderation.POST("/:id/ban", adminController.BanUser)
+			moderation.POST("/:id/unban", adminController.UnbanUser)
+			moderation.POST("/:id/suspend", adminController.SuspendUser)
+			moderation.POST("/:id/revoke-tokens", adminController.RevokeUserTokens)
+			moderation.POST("/:id/unlock", adminController.UnlockUser)
+		}
 
-		// Admin dashboard
-		admin.GET("/dashboard", adminController.GetDashboard)
+		// Role management
+		roles := admin.Group("/")
+		roles.Use(middleware.RequirePermission(models.PermRolesManage))
+		{
+			roles.GET("/roles", adminController.GetRoles)
+			roles.PUT("/users/:id/admin", adminController.SetUserAdmin)
+			roles.GET("/users/:id/roles", adminController.GetUserRoles)
+			roles.POST("/users/:id/roles", adminController.AssignRole)
+			roles.DELETE("/users/:id/roles/:role", adminController.RemoveRole)
+		}
+
+		// Score ledger management
+		scores := admin.Group("/")
+		scores.Use(middleware.RequirePermission(models.PermScoresManage))
+		{
+			scores.POST("/scores/recompute", adminController.RecomputeScores)
+			scores.GET("/scores/check", adminController.CheckScores)
+			scores.GET("/awards", adminController.GetAwards)
+			scores.POST("/awards", adminController.CreateAward)
+			scores.DELETE("/awards/:id", adminController.DeleteAward)
+		}
+
+		// Event configuration, release waves and announcements
+		event := admin.Group("/")
+		event.Use(middleware.RequirePermission(models.PermEventManage))
+		{
+			event.PUT("/event", eventController.UpdateEvent)
+			event.GET("/waves", adminController.GetWaves)
+			event.POST("/waves", adminController.CreateWave)
+			event.PUT("/waves/:id", adminController.UpdateWave)
+			event.POST("/waves/:id/release", adminController.ReleaseWave)
+			event.DELETE("/waves/:id", adminController.DeleteWave)
+			event.POST("/announcements", eventController.CreateAnnouncement)
+			event.DELETE("/announcements/:id", eventController.DeleteAnnouncement)
+		}
+
+		// Token signing keys
+		admin.POST("/keys/rotate", middleware.RequirePermission(models.PermSystemManage), adminController.RotateSigningKey)
 	}
 }
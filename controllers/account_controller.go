@@ -0,0 +1,291 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thelostleo/CTF-backend/database"
+	"github.com/thelostleo/CTF-backend/middleware"
+	"github.com/thelostleo/CTF-backend/models"
+	"github.com/thelostleo/CTF-backend/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type AccountController struct{}
+
+var errInvalidUserToken = errors.New("invalid or expired token")
+
+// emailVerificationTTL returns how long verification links stay valid (EMAIL_VERIFICATION_TTL, default 48h)
+func emailVerificationTTL() time.Duration {
+	return utils.GetEnvAsDuration("EMAIL_VERIFICATION_TTL", 48*time.Hour)
+}
+
+// passwordResetTTL returns how long password reset links stay valid (PASSWORD_RESET_TTL, default 1h)
+func passwordResetTTL() time.Duration {
+	return utils.GetEnvAsDuration("PASSWORD_RESET_TTL", time.Hour)
+}
+
+// issueUserToken creates a single-use token for the user, invalidating
+// earlier unused tokens with the same purpose
+func issueUserToken(tx *gorm.DB, user *models.User, purpose string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	if err := tx.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", user.ID, purpose).
+		Update("used_at", now).Error; err != nil {
+		return "", err
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	userToken := models.UserToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		TokenHash: utils.HashToken(token),
+		Email:     user.Email,
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := tx.Create(&userToken).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consumeUserToken marks a valid token as used and returns it together with its user
+func consumeUserToken(tx *gorm.DB, token, purpose string) (*models.UserToken, *models.User, error) {
+	var userToken models.UserToken
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ? AND purpose = ?", utils.HashToken(strings.TrimSpace(token)), purpose).
+		First(&userToken).Error; err != nil {
+		return nil, nil, errInvalidUserToken
+	}
+
+	now := time.Now()
+	if userToken.UsedAt != nil || now.After(userToken.ExpiresAt) {
+		return nil, nil, errInvalidUserToken
+	}
+
+	var user models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userToken.UserID).Error; err != nil {
+		return nil, nil, errInvalidUserToken
+	}
+
+	// Tokens are bound to the address they were sent to
+	if !strings.EqualFold(user.Email, userToken.Email) {
+		return nil, nil, errInvalidUserToken
+	}
+
+	if err := tx.Model(&userToken).Update("used_at", now).Error; err != nil {
+		return nil, nil, err
+	}
+	return &userToken, &user, nil
+}
+
+// sendVerificationEmail emails the user a link to verify their address
+func sendVerificationEmail(user *models.User) error {
+	token, err := issueUserToken(database.DB, user, models.TokenEmailVerification, emailVerificationTTL())
+	if err != nil {
+		return err
+	}
+
+	link := utils.GetAppURL() + "/verify-email?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Hi %s,\n\nPlease verify your email address by opening the link below:\n\n%s\n\nThe link expires in %s.\n",
+		user.Username, link, emailVerificationTTL())
+	return utils.GetMailer().Send(user.Email, "Verify your email address", body)
+}
+
+// sendPasswordResetEmail emails the user a link to choose a new password
+func sendPasswordResetEmail(user *models.User) error {
+	token, err := issueUserToken(database.DB, user, models.TokenPasswordReset, passwordResetTTL())
+	if err != nil {
+		return err
+	}
+
+	link := utils.GetAppURL() + "/reset-password?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Hi %s,\n\nSomeone requested a password reset for your account. To choose a new password, open the link below:\n\n%s\n\nThe link expires in %s. If you did not request this, you can ignore this email.\n",
+		user.Username, link, passwordResetTTL())
+	return utils.GetMailer().Send(user.Email, "Reset your password", body)
+}
+
+// VerifyEmail handles POST /verify-email
+func (ac *AccountController) VerifyEmail(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var user *models.User
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		_, user, err = consumeUserToken(tx, req.Token, models.TokenEmailVerification)
+		if err != nil {
+			return err
+		}
+		return tx.Model(user).Update("email_verified", true).Error
+	})
+	if errors.Is(err, errInvalidUserToken) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid or expired verification token",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to verify email",
+		})
+		return
+	}
+
+	middleware.InvalidateUserCache(user.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email verified successfully",
+	})
+}
+
+// ResendVerification handles POST /profile/verify-email/resend
+func (ac *AccountController) ResendVerification(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	if user.EmailVerified {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Email is already verified",
+		})
+		return
+	}
+
+	if err := sendVerificationEmail(&user); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to send verification email",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Verification email sent",
+	})
+}
+
+// ForgotPassword handles POST /forgot-password
+func (ac *AccountController) ForgotPassword(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	// Always answer the same way so the endpoint cannot be used to discover accounts
+	var user models.User
+	if err := database.DB.Where("LOWER(email) = LOWER(?)", req.Email).First(&user).Error; err == nil {
+		if err := sendPasswordResetEmail(&user); err != nil {
+			log.Printf("Failed to send password reset email to user %d: %v", user.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "If an account with that email exists, a password reset link has been sent",
+	})
+}
+
+// ResetPassword handles POST /reset-password
+func (ac *AccountController) ResetPassword(c *gin.Context) {
+	var req struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required,min=6,max=72"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(req.Password)
+	if errors.Is(err, utils.ErrPasswordTooLong) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Password is too long",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to reset password",
+		})
+		return
+	}
+
+	var user *models.User
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		_, user, err = consumeUserToken(tx, req.Token, models.TokenPasswordReset)
+		if err != nil {
+			return err
+		}
+
+		// Receiving the reset link also proves ownership of the address; every
+		// outstanding token and session is invalidated
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"password":       hashedPassword,
+			"email_verified": true,
+			"token_version":  gorm.Expr("token_version + 1"),
+		}).Error; err != nil {
+			return err
+		}
+		_, err = revokeSessions(tx, user.ID)
+		return err
+	})
+	if errors.Is(err, errInvalidUserToken) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid or expired reset token",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to reset password",
+		})
+		return
+	}
+
+	middleware.InvalidateUserCache(user.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Password reset successfully. Please log in with your new password.",
+	})
+}
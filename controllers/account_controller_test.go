@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thelostleo/CTF-backend/models"
+	"github.com/thelostleo/CTF-backend/utils"
+)
+
+// performJSON sends a JSON request to the router and returns the response
+func performJSON(router *gin.Engine, method, path string, body interface{}) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	request := httptest.NewRequest(method, path, bytes.NewReader(data))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// useLogMailer records emails in a file for the duration of the test
+func useLogMailer(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "mail.log")
+	previous := utils.GetMailer()
+	utils.SetMailer(&utils.LogMailer{Path: path})
+	t.Cleanup(func() { utils.SetMailer(previous) })
+	return path
+}
+
+// resetTokenPattern matches the token in a password reset link
+var resetTokenPattern = regexp.MustCompile(`/reset-password\?token=([0-9a-f]+)`)
+
+// mailedResetTokens returns the reset tokens in the mail log, oldest first
+func mailedResetTokens(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read mail log: %v", err)
+	}
+	var tokens []string
+	for _, match := range resetTokenPattern.FindAllStringSubmatch(string(data), -1) {
+		tokens = append(tokens, match[1])
+	}
+	return tokens
+}
+
+// accountRouter serves the password reset endpoints
+func accountRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	controller := &AccountController{}
+	router.POST("/forgot-password", controller.ForgotPassword)
+	router.POST("/reset-password", controller.ResetPassword)
+	return router
+}
+
+func TestPasswordResetTokenIsSingleUse(t *testing.T) {
+	db := setupTestDB(t)
+	mailLog := useLogMailer(t)
+	router := accountRouter()
+	user := createTestUser(t, db, "forgetful", nil)
+
+	if w := performJSON(router, http.MethodPost, "/forgot-password", gin.H{"email": user.Email}); w.Code != http.StatusOK {
+		t.Fatalf("forgot password: got %d", w.Code)
+	}
+	tokens := mailedResetTokens(t, mailLog)
+	if len(tokens) != 1 {
+		t.Fatalf("want 1 mailed token, got %d", len(tokens))
+	}
+
+	// Only the hash of the token is stored
+	var stored models.UserToken
+	db.Where("user_id = ?", user.ID).First(&stored)
+	if stored.TokenHash != utils.HashToken(tokens[0]) {
+		t.Fatalf("stored token hash does not match the mailed token")
+	}
+
+	reset := gin.H{"token": tokens[0], "password": "new-password"}
+	if w := performJSON(router, http.MethodPost, "/reset-password", reset); w.Code != http.StatusOK {
+		t.Fatalf("reset password: got %d: %s", w.Code, w.Body.String())
+	}
+
+	var reloaded models.User
+	db.First(&reloaded, user.ID)
+	if ok, _, _ := utils.VerifyPassword(reloaded.Password, "new-password"); !ok {
+		t.Fatalf("password was not changed")
+	}
+	if reloaded.TokenVersion != user.TokenVersion+1 {
+		t.Fatalf("want token version %d, got %d", user.TokenVersion+1, reloaded.TokenVersion)
+	}
+
+	reset["password"] = "another-password"
+	if w := performJSON(router, http.MethodPost, "/reset-password", reset); w.Code != http.StatusBadRequest {
+		t.Fatalf("reused token: want 400, got %d", w.Code)
+	}
+}
+
+func TestPasswordResetInvalidatesEarlierTokens(t *testing.T) {
+	db := setupTestDB(t)
+	mailLog := useLogMailer(t)
+	router := accountRouter()
+	user := createTestUser(t, db, "twice", nil)
+
+	for i := 0; i < 2; i++ {
+		performJSON(router, http.MethodPost, "/forgot-password", gin.H{"email": user.Email})
+	}
+	tokens := mailedResetTokens(t, mailLog)
+	if len(tokens) != 2 {
+		t.Fatalf("want 2 mailed tokens, got %d", len(tokens))
+	}
+
+	if w := performJSON(router, http.MethodPost, "/reset-password", gin.H{"token": tokens[0], "password": "new-password"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("superseded token: want 400, got %d", w.Code)
+	}
+	if w := performJSON(router, http.MethodPost, "/reset-password", gin.H{"token": tokens[1], "password": "new-password"}); w.Code != http.StatusOK {
+		t.Fatalf("latest token: want 200, got %d", w.Code)
+	}
+}
+
+func TestForgotPasswordUnknownEmailSendsNothing(t *testing.T) {
+	setupTestDB(t)
+	mailLog := useLogMailer(t)
+
+	w := performJSON(accountRouter(), http.MethodPost, "/forgot-password", gin.H{"email": "nobody@example.com"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("want 200 so accounts cannot be discovered, got %d", w.Code)
+	}
+	if _, err := os.Stat(mailLog); !os.IsNotExist(err) {
+		t.Fatalf("want no email to be sent")
+	}
+}
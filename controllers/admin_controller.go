@@ -1,27 +1,125 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/thelostleo/CTF-backend/database"
+	"github.com/thelostleo/CTF-backend/middleware"
 	"github.com/thelostleo/CTF-backend/models"
+	"github.com/thelostleo/CTF-backend/utils"
+	"gorm.io/gorm"
 )
 
 type AdminController struct{}
 
+// hintRequest is the admin input for creating or updating a hint
+type hintRequest struct {
+	Content  string `json:"content" binding:"required"`
+	Cost     int    `json:"cost" binding:"min=0"`
+	Position *int   `json:"position"`
+}
+
+// flagRequest is the admin input for an accepted flag
+type flagRequest struct {
+	Content string `json:"content" binding:"required"`
+	Type    string `json:"type"` // static (default), case_insensitive or regex
+}
+
+// buildFlags combines the legacy single flag and the flags list into validated flags
+func buildFlags(flag string, requests []flagRequest) ([]models.ChallengeFlag, error) {
+	var flags []models.ChallengeFlag
+	if flag != "" {
+		flags = append(flags, models.ChallengeFlag{Content: flag, Type: models.FlagStatic})
+	}
+	for _, request := range requests {
+		flags = append(flags, models.ChallengeFlag{Content: request.Content, Type: request.Type})
+	}
+
+	for i := range flags {
+		if err := flags[i].Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return flags, nil
+}
+
+// replaceFlags swaps every accepted flag of a challenge for the given ones
+func replaceFlags(tx *gorm.DB, challengeID uint, flags []models.ChallengeFlag) error {
+	if err := tx.Where("challenge_id = ?", challengeID).Delete(&models.ChallengeFlag{}).Error; err != nil {
+		return err
+	}
+	for i := range flags {
+		flags[i].ID = 0
+		flags[i].ChallengeID = challengeID
+	}
+	return tx.Create(&flags).Error
+}
+
+// adminFlagsResponse lists flags including their content for admins
+func adminFlagsResponse(flags []models.ChallengeFlag) []gin.H {
+	response := make([]gin.H, len(flags))
+	for i, flag := range flags {
+		response[i] = gin.H{
+			"id":     flag.ID,
+			"type":   flag.Type,
+			"hashed": utils.IsHashedFlag(flag.Content),
+		}
+		// Hashed flags cannot be shown back, encrypted ones are decrypted for admins
+		if content, err := flag.Plaintext(); err == nil {
+			response[i]["content"] = content
+		}
+	}
+	return response
+}
+
+// adminHintsResponse lists hints including their content for admins
+func adminHintsResponse(hints []models.Hint) []gin.H {
+	response := make([]gin.H, len(hints))
+	for i, hint := range hints {
+		response[i] = gin.H{
+			"id":       hint.ID,
+			"content":  hint.Content,
+			"cost":     hint.Cost,
+			"position": hint.Position,
+		}
+	}
+	return response
+}
+
 // CreateChallenge handles POST /admin/challenges
 func (ac *AdminController) CreateChallenge(c *gin.Context) {
 	var req struct {
+		Slug        string `json:"slug"` // Generated from the title when empty
 		Title       string `json:"title" binding:"required"`
 		Description string `json:"description"`
 		Category    string `json:"category" binding:"required"`
 		Points      int    `json:"points" binding:"required,min=1"`
-		Flag        string `json:"flag" binding:"required"`
-		Hint        string `json:"hint"`
+		Flag        string `json:"flag"` // Single static flag, kept for compatibility
+		Hint        string `json:"hint"` // Single free hint, kept for compatibility
 		FileURL     string `json:"file_url"`
 		IsActive    *bool  `json:"is_active"` // Pointer to handle optional boolean
+
+		Difficulty string   `json:"difficulty"`
+		Tags       []string `json:"tags"`
+
+		Flags []flagRequest `json:"flags" binding:"dive"`
+		Hints []hintRequest `json:"hints" binding:"dive"`
+
+		// Dynamic scoring (optional)
+		ScoringType   string `json:"scoring_type"`
+		InitialPoints int    `json:"initial_points"`
+		MinimumPoints int    `json:"minimum_points"`
+		Decay         int    `json:"decay"`
+		DecayFunction string `json:"decay_function"`
+
+		// Scheduled release (optional)
+		ReleaseAt *time.Time `json:"release_at"`
+		HideAt    *time.Time `json:"hide_at"`
+		WaveID    *uint      `json:"wave_id"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -32,6 +130,34 @@ func (ac *AdminController) CreateChallenge(c *gin.Context) {
 		return
 	}
 
+	flags, err := buildFlags(req.Flag, req.Flags)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid flags",
+			"details": err.Error(),
+		})
+		return
+	}
+	if len(flags) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "At least one flag is required",
+		})
+		return
+	}
+
+	if !models.ValidDifficulty(req.Difficulty) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Difficulty must be easy, medium, hard or insane",
+		})
+		return
+	}
+
+	slug, err := challengeSlug(database.DB, req.Slug, req.Title, 0)
+	if err != nil {
+		respondSlugError(c, err)
+		return
+	}
+
 	// Set default value for IsActive if not provided
 	isActive := true
 	if req.IsActive != nil {
@@ -39,17 +165,76 @@ func (ac *AdminController) CreateChallenge(c *gin.Context) {
 	}
 
 	challenge := models.Challenge{
+		Slug:        slug,
 		Title:       req.Title,
+		Difficulty:  req.Difficulty,
 		Description: req.Description,
 		Category:    req.Category,
 		Points:      req.Points,
-		Flag:        req.Flag,
-		Hint:        req.Hint,
 		FileURL:     req.FileURL,
 		IsActive:    isActive,
+		Flags:       flags,
+
+		ScoringType:   req.ScoringType,
+		InitialPoints: req.InitialPoints,
+		MinimumPoints: req.MinimumPoints,
+		Decay:         req.Decay,
+		DecayFunction: req.DecayFunction,
+
+		ReleaseAt: req.ReleaseAt,
+		HideAt:    req.HideAt,
+		WaveID:    req.WaveID,
+	}
+
+	// The creator becomes the author, who may keep editing the challenge
+	authorID := c.GetUint("userID")
+	challenge.AuthorID = &authorID
+
+	if err := validateScoring(&challenge); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid scoring configuration",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if err := validateSchedule(database.DB, challenge.ReleaseAt, challenge.HideAt, challenge.WaveID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid release schedule",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	// Dynamic challenges start at their initial value
+	if challenge.IsDynamic() {
+		challenge.Points = challenge.InitialPoints
+	}
+
+	if req.Hint != "" {
+		challenge.Hints = append(challenge.Hints, models.Hint{Content: req.Hint})
+	}
+	for _, hint := range req.Hints {
+		challenge.Hints = append(challenge.Hints, models.Hint{
+			Content:  hint.Content,
+			Cost:     hint.Cost,
+			Position: len(challenge.Hints),
+		})
 	}
 
-	if err := database.DB.Create(&challenge).Error; err != nil {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		tags, err := findOrCreateTags(tx, req.Tags)
+		if err != nil {
+			return err
+		}
+		challenge.Tags = tags
+		return tx.Create(&challenge).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			respondSlugError(c, errSlugTaken)
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to create challenge",
 		})
@@ -59,14 +244,22 @@ func (ac *AdminController) CreateChallenge(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Challenge created successfully",
 		"challenge": gin.H{
-			"id":          challenge.ID,
-			"title":       challenge.Title,
-			"description": challenge.Description,
-			"category":    challenge.Category,
-			"points":      challenge.Points,
-			"hint":        challenge.Hint,
-			"file_url":    challenge.FileURL,
-			"is_active":   challenge.IsActive,
+			"id":           challenge.ID,
+			"slug":         challenge.Slug,
+			"title":        challenge.Title,
+			"description":  challenge.Description,
+			"category":     challenge.Category,
+			"difficulty":   challenge.Difficulty,
+			"tags":         challenge.Tags,
+			"points":       challenge.Points,
+			"scoring_type": challenge.ScoringType,
+			"flags":        adminFlagsResponse(challenge.Flags),
+			"hints":        adminHintsResponse(challenge.Hints),
+			"file_url":     challenge.FileURL,
+			"is_active":    challenge.IsActive,
+			"release_at":   challenge.ReleaseAt,
+			"hide_at":      challenge.HideAt,
+			"wave_id":      challenge.WaveID,
 		},
 	})
 }
@@ -75,7 +268,7 @@ func (ac *AdminController) CreateChallenge(c *gin.Context) {
 func (ac *AdminController) GetAllUsers(c *gin.Context) {
 	var users []models.User
 
-	if err := database.DB.Select("id, username, email, score, is_admin, created_at").
+	if err := database.DB.Select("id, username, email, score, is_admin, is_banned, ban_reason, suspended_until, created_at").
 		Find(&users).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to fetch users",
@@ -89,6 +282,292 @@ func (ac *AdminController) GetAllUsers(c *gin.Context) {
 	})
 }
 
+// findUserParam loads the user referenced by the :id route parameter,
+// writing an error response when it is invalid or missing
+func findUserParam(c *gin.Context) (*models.User, bool) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user ID",
+		})
+		return nil, false
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "User not found",
+		})
+		return nil, false
+	}
+	return &user, true
+}
+
+// isSelf reports whether the admin is acting on their own account
+func isSelf(c *gin.Context, user *models.User) bool {
+	return c.GetUint("userID") == user.ID
+}
+
+// authorizeChallenge checks that the current user may manage the challenge:
+// challenge authors only their own, users with challenges.write_all any.
+// It writes an error response and returns false otherwise.
+func authorizeChallenge(c *gin.Context, challengeID uint) bool {
+	var challenge models.Challenge
+	if err := database.DB.Select("id, author_id").First(&challenge, challengeID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Challenge not found",
+		})
+		return false
+	}
+
+	if middleware.HasPermission(c, models.PermChallengesWriteAll) {
+		return true
+	}
+	if challenge.AuthorID == nil || *challenge.AuthorID != c.GetUint("userID") {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "You can only manage challenges you authored",
+		})
+		return false
+	}
+	return true
+}
+
+// authorizeModeration checks that the current user may ban, suspend or revoke
+// the tokens of the user: admins must be demoted first and staff can only be
+// moderated by someone holding each of their roles. It writes an error
+// response and returns false otherwise.
+func authorizeModeration(c *gin.Context, user *models.User) bool {
+	if user.IsAdmin {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Admins must be demoted before they can be moderated",
+		})
+		return false
+	}
+
+	if err := database.DB.Model(user).Association("Roles").Find(&user.Roles); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch roles",
+		})
+		return false
+	}
+
+	callerRoles := make(map[string]bool)
+	for _, role := range c.GetStringSlice("roles") {
+		callerRoles[role] = true
+	}
+	for _, role := range user.RoleNames() {
+		if !callerRoles[role] {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "You cannot moderate a user holding a role you do not have",
+				"role":  role,
+			})
+			return false
+		}
+	}
+	return true
+}
+
+// restrictUser applies access changes to a user, optionally invalidating
+// every outstanding token and session, and drops the cached user state
+func restrictUser(userID uint, updates map[string]interface{}, revokeTokens bool) error {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if revokeTokens {
+			updates["token_version"] = gorm.Expr("token_version + 1")
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(updates).Error; err != nil {
+			return err
+		}
+		if revokeTokens {
+			_, err := revokeSessions(tx, userID)
+			return err
+		}
+		return nil
+	})
+	middleware.InvalidateUserCache(userID)
+	return err
+}
+
+// BanUser handles POST /admin/users/:id/ban
+func (ac *AdminController) BanUser(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if isSelf(c, user) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "You cannot ban yourself",
+		})
+		return
+	}
+	if !authorizeModeration(c, user) {
+		return
+	}
+
+	if err := restrictUser(user.ID, map[string]interface{}{
+		"is_banned":  true,
+		"ban_reason": req.Reason,
+	}, true); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to ban user",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User banned successfully",
+	})
+}
+
+// UnbanUser handles POST /admin/users/:id/unban
+func (ac *AdminController) UnbanUser(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+
+	// Lifting a ban also lifts any suspension
+	if err := restrictUser(user.ID, map[string]interface{}{
+		"is_banned":       false,
+		"ban_reason":      "",
+		"suspended_until": nil,
+	}, false); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to unban user",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User unbanned successfully",
+	})
+}
+
+// SuspendUser handles POST /admin/users/:id/suspend
+func (ac *AdminController) SuspendUser(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Duration string `json:"duration" binding:"required"` // e.g. "24h"
+		Reason   string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	duration, err := time.ParseDuration(req.Duration)
+	if err != nil || duration <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Duration must be a positive duration such as 30m or 24h",
+		})
+		return
+	}
+
+	if isSelf(c, user) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "You cannot suspend yourself",
+		})
+		return
+	}
+	if !authorizeModeration(c, user) {
+		return
+	}
+
+	suspendedUntil := time.Now().Add(duration)
+	if err := restrictUser(user.ID, map[string]interface{}{
+		"suspended_until": suspendedUntil,
+		"ban_reason":      req.Reason,
+	}, true); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to suspend user",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "User suspended successfully",
+		"suspended_until": suspendedUntil,
+	})
+}
+
+// RevokeUserTokens handles POST /admin/users/:id/revoke-tokens
+func (ac *AdminController) RevokeUserTokens(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok || !authorizeModeration(c, user) {
+		return
+	}
+
+	if err := restrictUser(user.ID, map[string]interface{}{}, true); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to revoke tokens",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "All tokens of the user have been revoked",
+	})
+}
+
+// SetUserAdmin handles PUT /admin/users/:id/admin
+func (ac *AdminController) SetUserAdmin(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		IsAdmin *bool `json:"is_admin" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if isSelf(c, user) && !*req.IsAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "You cannot remove your own admin rights",
+		})
+		return
+	}
+
+	// Takes effect on the next request since authorization uses current user state
+	if err := restrictUser(user.ID, map[string]interface{}{
+		"is_admin": *req.IsAdmin,
+	}, false); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update admin rights",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Admin rights updated successfully",
+		"is_admin": *req.IsAdmin,
+	})
+}
+
 // UpdateChallenge handles PUT /admin/challenges/:id
 func (ac *AdminController) UpdateChallenge(c *gin.Context) {
 	id := c.Param("id")
@@ -100,15 +579,31 @@ func (ac *AdminController) UpdateChallenge(c *gin.Context) {
 		return
 	}
 
+	if !authorizeChallenge(c, uint(challengeID)) {
+		return
+	}
+
 	var req struct {
+		Slug        string `json:"slug"`
 		Title       string `json:"title"`
 		Description string `json:"description"`
 		Category    string `json:"category"`
 		Points      int    `json:"points,omitempty"`
-		Flag        string `json:"flag"`
-		Hint        string `json:"hint"`
+		Flag        string `json:"flag"` // Replaces all flags with a single static flag
 		FileURL     string `json:"file_url"`
 		IsActive    *bool  `json:"is_active"`
+
+		Difficulty *string   `json:"difficulty"` // Empty clears the difficulty
+		Tags       *[]string `json:"tags"`       // Replaces all tags when present
+
+		Flags []flagRequest `json:"flags" binding:"dive"` // Replaces all flags when present
+
+		// Dynamic scoring (optional)
+		ScoringType   string `json:"scoring_type"`
+		InitialPoints int    `json:"initial_points"`
+		MinimumPoints *int   `json:"minimum_points"`
+		Decay         int    `json:"decay"`
+		DecayFunction string `json:"decay_function"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -130,6 +625,14 @@ func (ac *AdminController) UpdateChallenge(c *gin.Context) {
 
 	// Update fields if provided
 	updates := make(map[string]interface{})
+	if req.Slug != "" && req.Slug != challenge.Slug {
+		slug, err := challengeSlug(database.DB, req.Slug, "", challenge.ID)
+		if err != nil {
+			respondSlugError(c, err)
+			return
+		}
+		updates["slug"] = slug
+	}
 	if req.Title != "" {
 		updates["title"] = req.Title
 	}
@@ -142,20 +645,107 @@ func (ac *AdminController) UpdateChallenge(c *gin.Context) {
 	if req.Points > 0 {
 		updates["points"] = req.Points
 	}
-	if req.Flag != "" {
-		updates["flag"] = req.Flag
-	}
-	if req.Hint != "" {
-		updates["hint"] = req.Hint
-	}
 	if req.FileURL != "" {
 		updates["file_url"] = req.FileURL
 	}
 	if req.IsActive != nil {
 		updates["is_active"] = *req.IsActive
 	}
+	if req.Difficulty != nil {
+		if !models.ValidDifficulty(*req.Difficulty) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Difficulty must be easy, medium, hard or insane",
+			})
+			return
+		}
+		updates["difficulty"] = *req.Difficulty
+	}
+
+	flags, err := buildFlags(req.Flag, req.Flags)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid flags",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	// Apply scoring changes to a copy first so they can be validated together
+	scoring := challenge
+	if req.ScoringType != "" {
+		scoring.ScoringType = req.ScoringType
+	}
+	if req.InitialPoints > 0 {
+		scoring.InitialPoints = req.InitialPoints
+	}
+	if req.MinimumPoints != nil {
+		scoring.MinimumPoints = *req.MinimumPoints
+	}
+	if req.Decay > 0 {
+		scoring.Decay = req.Decay
+	}
+	if req.DecayFunction != "" {
+		scoring.DecayFunction = req.DecayFunction
+	}
+	if req.Points > 0 {
+		scoring.Points = req.Points
+	}
+	if err := validateScoring(&scoring); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid scoring configuration",
+			"details": err.Error(),
+		})
+		return
+	}
+	updates["scoring_type"] = scoring.ScoringType
+	updates["initial_points"] = scoring.InitialPoints
+	updates["minimum_points"] = scoring.MinimumPoints
+	updates["decay"] = scoring.Decay
+	updates["decay_function"] = scoring.DecayFunction
+
+	// The value of a dynamic challenge is derived from its solves
+	if scoring.IsDynamic() {
+		delete(updates, "points")
+	}
 
-	if err := database.DB.Model(&challenge).Updates(updates).Error; err != nil {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&challenge).Updates(updates).Error; err != nil {
+			return err
+		}
+		if len(flags) > 0 {
+			if err := replaceFlags(tx, challenge.ID, flags); err != nil {
+				return err
+			}
+		}
+		if req.Tags != nil {
+			tags, err := findOrCreateTags(tx, *req.Tags)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&challenge).Association("Tags").Replace(tags); err != nil {
+				return err
+			}
+		}
+		challenge.ScoringType = scoring.ScoringType
+		challenge.InitialPoints = scoring.InitialPoints
+		challenge.MinimumPoints = scoring.MinimumPoints
+		challenge.Decay = scoring.Decay
+		challenge.DecayFunction = scoring.DecayFunction
+
+		// Re-derive the current value so solvers are re-scored under the new parameters
+		if err := recalculateChallengeValue(tx, &challenge); err != nil {
+			return err
+		}
+		if _, ok := updates["points"]; ok {
+			return syncSolverScores(tx, challenge.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			respondSlugError(c, errSlugTaken)
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to update challenge",
 		})
@@ -168,6 +758,9 @@ func (ac *AdminController) UpdateChallenge(c *gin.Context) {
 	})
 }
 
+// errChallengeHasDependents is returned when other challenges require the one being deleted
+var errChallengeHasDependents = errors.New("challenge is required by other challenges")
+
 // DeleteChallenge handles DELETE /admin/challenges/:id
 func (ac *AdminController) DeleteChallenge(c *gin.Context) {
 	id := c.Param("id")
@@ -179,8 +772,51 @@ func (ac *AdminController) DeleteChallenge(c *gin.Context) {
 		return
 	}
 
-	// Soft delete the challenge
-	if err := database.DB.Delete(&models.Challenge{}, challengeID).Error; err != nil {
+	if !authorizeChallenge(c, uint(challengeID)) {
+		return
+	}
+
+	// Deleting a challenge other challenges require would silently unlock
+	// them, so that has to be asked for with ?force=true
+	force := c.Query("force") == "true"
+
+	// Soft delete the challenge and drop its points from the solvers' scores
+	var dependents []struct {
+		ID    uint   `json:"id"`
+		Title string `json:"title"`
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Challenge{}).
+			Select("challenges.id, challenges.title").
+			Joins("JOIN challenge_prerequisites ON challenge_prerequisites.challenge_id = challenges.id").
+			Where("challenge_prerequisites.required_challenge_id = ? AND challenges.id <> ?", challengeID, challengeID).
+			Distinct().
+			Order("challenges.id ASC").
+			Scan(&dependents).Error; err != nil {
+			return err
+		}
+		if len(dependents) > 0 && !force {
+			return errChallengeHasDependents
+		}
+
+		if err := tx.Delete(&models.Challenge{}, challengeID).Error; err != nil {
+			return err
+		}
+		// Challenges that required this one no longer wait for it
+		if err := tx.Where("challenge_id = ? OR required_challenge_id = ?", challengeID, challengeID).
+			Delete(&models.ChallengePrerequisite{}).Error; err != nil {
+			return err
+		}
+		return syncSolverScores(tx, uint(challengeID))
+	})
+	if errors.Is(err, errChallengeHasDependents) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":      "Other challenges require this challenge; remove the prerequisites or delete with force=true",
+			"dependents": dependents,
+		})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to delete challenge",
 		})
@@ -188,7 +824,8 @@ func (ac *AdminController) DeleteChallenge(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Challenge deleted successfully",
+		"message":             "Challenge deleted successfully",
+		"unlocked_dependents": dependents,
 	})
 }
 
@@ -203,19 +840,525 @@ func (ac *AdminController) GetDashboard(c *gin.Context) {
 	database.DB.Model(&models.Challenge{}).Where("is_active = ?", true).Count(&challengeCount)
 	database.DB.Model(&models.Submission{}).Count(&submissionCount)
 
+	var cheatIncidentCount int64
+	database.DB.Model(&models.CheatIncident{}).Count(&cheatIncidentCount)
+
+	// Only the username of players is shown, and challenge authors only see
+	// activity on their own challenges
+	players := func(db *gorm.DB) *gorm.DB { return db.Select("id, username") }
+	titles := func(db *gorm.DB) *gorm.DB { return db.Select("id, title") }
+	ownChallenges := func(db *gorm.DB) *gorm.DB {
+		if middleware.HasPermission(c, models.PermChallengesWriteAll) {
+			return db
+		}
+		return db.Where("challenge_id IN (?)",
+			database.DB.Model(&models.Challenge{}).Select("id").Where("author_id = ?", c.GetUint("userID")))
+	}
+
+	// Get recent cheating incidents (dynamic flags submitted by the wrong user or team)
+	recentCheatIncidents := []gin.H{}
+	if middleware.HasPermission(c, models.PermCheatView) {
+		var incidents []models.CheatIncident
+		database.DB.Preload("User", players).Preload("Challenge", titles).
+			Order("created_at DESC").
+			Limit(10).
+			Find(&incidents)
+		for _, incident := range incidents {
+			recentCheatIncidents = append(recentCheatIncidents, gin.H{
+				"id":         incident.ID,
+				"user":       gin.H{"id": incident.User.ID, "username": incident.User.Username},
+				"team_id":    incident.TeamID,
+				"challenge":  gin.H{"id": incident.Challenge.ID, "title": incident.Challenge.Title},
+				"flag_owner": incident.FlagOwner,
+				"created_at": incident.CreatedAt,
+			})
+		}
+	}
+
 	// Get recent submissions
-	var recentSubmissions []models.Submission
-	database.DB.Preload("User").Preload("Challenge").
+	var submissions []models.Submission
+	database.DB.Scopes(ownChallenges).
+		Preload("User", players).Preload("Challenge", titles).
 		Order("submitted_at DESC").
 		Limit(10).
-		Find(&recentSubmissions)
+		Find(&submissions)
+	recentSubmissions := make([]gin.H, len(submissions))
+	for i, submission := range submissions {
+		recentSubmissions[i] = gin.H{
+			"id":           submission.ID,
+			"user":         gin.H{"id": submission.User.ID, "username": submission.User.Username},
+			"team_id":      submission.TeamID,
+			"challenge":    gin.H{"id": submission.Challenge.ID, "title": submission.Challenge.Title},
+			"is_correct":   submission.IsCorrect,
+			"submitted_at": submission.SubmittedAt,
+		}
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"statistics": gin.H{
 			"total_users":       userCount,
 			"active_challenges": challengeCount,
 			"total_submissions": submissionCount,
+			"cheat_incidents":   cheatIncidentCount,
 		},
-		"recent_submissions": recentSubmissions,
+		"recent_submissions":     recentSubmissions,
+		"recent_cheat_incidents": recentCheatIncidents,
+	})
+}
+
+// RecomputeScores handles POST /admin/scores/recompute
+func (ac *AdminController) RecomputeScores(c *gin.Context) {
+	var usersUpdated, teamsUpdated int64
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		usersUpdated, teamsUpdated, err = recomputeAllScores(tx)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to recompute scores",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Scores recomputed successfully",
+		"users_updated": usersUpdated,
+		"teams_updated": teamsUpdated,
+	})
+}
+
+// CheckScores handles GET /admin/scores/check
+func (ac *AdminController) CheckScores(c *gin.Context) {
+	users, teams, err := findScoreDiscrepancies(database.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to check scores",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"consistent": len(users) == 0 && len(teams) == 0,
+		"users":      users,
+		"teams":      teams,
+	})
+}
+
+// GetChallengeHints handles GET /admin/challenges/:id/hints
+func (ac *AdminController) GetChallengeHints(c *gin.Context) {
+	id := c.Param("id")
+	challengeID, err := strconv.Atoi(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid challenge ID",
+		})
+		return
+	}
+
+	if !authorizeChallenge(c, uint(challengeID)) {
+		return
+	}
+
+	var challenge models.Challenge
+	if err := database.DB.Preload("Hints", orderHints).First(&challenge, challengeID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Challenge not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"hints": adminHintsResponse(challenge.Hints),
+	})
+}
+
+// CreateHint handles POST /admin/challenges/:id/hints
+func (ac *AdminController) CreateHint(c *gin.Context) {
+	id := c.Param("id")
+	challengeID, err := strconv.Atoi(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid challenge ID",
+		})
+		return
+	}
+
+	if !authorizeChallenge(c, uint(challengeID)) {
+		return
+	}
+
+	var req hintRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var challenge models.Challenge
+	if err := database.DB.First(&challenge, challengeID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Challenge not found",
+		})
+		return
+	}
+
+	hint := models.Hint{
+		ChallengeID: challenge.ID,
+		Content:     req.Content,
+		Cost:        req.Cost,
+	}
+
+	// Append to the end unless a position is given
+	if req.Position != nil {
+		hint.Position = *req.Position
+	} else {
+		var count int64
+		database.DB.Model(&models.Hint{}).Where("challenge_id = ?", challenge.ID).Count(&count)
+		hint.Position = int(count)
+	}
+
+	if err := database.DB.Create(&hint).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create hint",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Hint created successfully",
+		"hint":    adminHintsResponse([]models.Hint{hint})[0],
+	})
+}
+
+// UpdateHint handles PUT /admin/hints/:id
+func (ac *AdminController) UpdateHint(c *gin.Context) {
+	id := c.Param("id")
+	hintID, err := strconv.Atoi(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid hint ID",
+		})
+		return
+	}
+
+	var req struct {
+		Content  string `json:"content"`
+		Cost     *int   `json:"cost" binding:"omitempty,min=0"`
+		Position *int   `json:"position"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var hint models.Hint
+	if err := database.DB.First(&hint, hintID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Hint not found",
+		})
+		return
+	}
+
+	if !authorizeChallenge(c, hint.ChallengeID) {
+		return
+	}
+
+	// Changing the cost only affects future unlocks
+	updates := make(map[string]interface{})
+	if req.Content != "" {
+		updates["content"] = req.Content
+	}
+	if req.Cost != nil {
+		updates["cost"] = *req.Cost
+	}
+	if req.Position != nil {
+		updates["position"] = *req.Position
+	}
+
+	if err := database.DB.Model(&hint).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update hint",
+		})
+		return
+	}
+	database.DB.First(&hint, hint.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Hint updated successfully",
+		"hint":    adminHintsResponse([]models.Hint{hint})[0],
+	})
+}
+
+// DeleteHint handles DELETE /admin/hints/:id
+func (ac *AdminController) DeleteHint(c *gin.Context) {
+	id := c.Param("id")
+	hintID, err := strconv.Atoi(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid hint ID",
+		})
+		return
+	}
+
+	var hint models.Hint
+	if err := database.DB.First(&hint, hintID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Hint not found",
+		})
+		return
+	}
+
+	if !authorizeChallenge(c, hint.ChallengeID) {
+		return
+	}
+
+	// Soft delete keeps past unlocks (and their cost) in the ledger
+	if err := database.DB.Delete(&hint).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to delete hint",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Hint deleted successfully",
+	})
+}
+
+// GetChallengeFlags handles GET /admin/challenges/:id/flags
+func (ac *AdminController) GetChallengeFlags(c *gin.Context) {
+	id := c.Param("id")
+	challengeID, err := strconv.Atoi(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid challenge ID",
+		})
+		return
+	}
+
+	if !authorizeChallenge(c, uint(challengeID)) {
+		return
+	}
+
+	var challenge models.Challenge
+	if err := database.DB.Preload("Flags").First(&challenge, challengeID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Challenge not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"flags": adminFlagsResponse(challenge.Flags),
+	})
+}
+
+// CreateFlag handles POST /admin/challenges/:id/flags
+func (ac *AdminController) CreateFlag(c *gin.Context) {
+	id := c.Param("id")
+	challengeID, err := strconv.Atoi(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid challenge ID",
+		})
+		return
+	}
+
+	if !authorizeChallenge(c, uint(challengeID)) {
+		return
+	}
+
+	var req flagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var challenge models.Challenge
+	if err := database.DB.First(&challenge, challengeID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Challenge not found",
+		})
+		return
+	}
+
+	flag := models.ChallengeFlag{
+		ChallengeID: challenge.ID,
+		Content:     req.Content,
+		Type:        req.Type,
+	}
+	if err := flag.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid flag",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if err := database.DB.Create(&flag).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create flag",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Flag created successfully",
+		"flag":    adminFlagsResponse([]models.ChallengeFlag{flag})[0],
+	})
+}
+
+// DeleteFlag handles DELETE /admin/flags/:id
+func (ac *AdminController) DeleteFlag(c *gin.Context) {
+	id := c.Param("id")
+	flagID, err := strconv.Atoi(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid flag ID",
+		})
+		return
+	}
+
+	var flag models.ChallengeFlag
+	if err := database.DB.First(&flag, flagID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Flag not found",
+		})
+		return
+	}
+
+	if !authorizeChallenge(c, flag.ChallengeID) {
+		return
+	}
+
+	// A challenge must always keep at least one accepted flag
+	var remaining int64
+	database.DB.Model(&models.ChallengeFlag{}).
+		Where("challenge_id = ? AND id <> ?", flag.ChallengeID, flag.ID).
+		Count(&remaining)
+	if remaining == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Cannot delete the last flag of a challenge",
+		})
+		return
+	}
+
+	if err := database.DB.Delete(&flag).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to delete flag",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Flag deleted successfully",
+	})
+}
+
+// GetCheatIncidents handles GET /admin/cheat-incidents
+func (ac *AdminController) GetCheatIncidents(c *gin.Context) {
+	var incidents []models.CheatIncident
+
+	if err := database.DB.Preload("User").Preload("Challenge").
+		Order("created_at DESC").
+		Find(&incidents).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch cheat incidents",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"incidents":       incidents,
+		"total_incidents": len(incidents),
+	})
+}
+
+// DeriveDynamicFlag handles GET /admin/challenges/:id/flags/derive?user_id=&team_id=
+func (ac *AdminController) DeriveDynamicFlag(c *gin.Context) {
+	id := c.Param("id")
+	challengeID, err := strconv.Atoi(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid challenge ID",
+		})
+		return
+	}
+
+	if !authorizeChallenge(c, uint(challengeID)) {
+		return
+	}
+
+	var owner string
+	if teamID, err := strconv.Atoi(c.Query("team_id")); err == nil {
+		tid := uint(teamID)
+		owner = models.FlagOwner(0, &tid)
+	} else if userID, err := strconv.Atoi(c.Query("user_id")); err == nil {
+		owner = models.FlagOwner(uint(userID), nil)
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "user_id or team_id is required",
+		})
+		return
+	}
+
+	var flags []models.ChallengeFlag
+	if err := database.DB.Where("challenge_id = ? AND type = ?", challengeID, models.FlagDynamic).
+		Order("id ASC").
+		Find(&flags).Error; err != nil || len(flags) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Challenge has no dynamic flag",
+		})
+		return
+	}
+
+	derived := make([]string, len(flags))
+	for i, flag := range flags {
+		secret, err := flag.Plaintext()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to decrypt flag secret",
+			})
+			return
+		}
+		derived[i] = utils.DeriveFlag(secret, flag.ChallengeID, owner)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"owner": owner,
+		"flags": derived,
+	})
+}
+
+// RotateSigningKey handles POST /admin/keys/rotate
+func (ac *AdminController) RotateSigningKey(c *gin.Context) {
+	ring, err := utils.GetKeyRing()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Signing keys unavailable",
+		})
+		return
+	}
+
+	if err := ring.Rotate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Failed to rotate signing key",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "New signing key published; it signs once the JWKS cache period has passed",
+		"keys":    ring.JWKS(),
 	})
 }
@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thelostleo/CTF-backend/database"
+	"github.com/thelostleo/CTF-backend/models"
+	"github.com/thelostleo/CTF-backend/utils"
+)
+
+type APITokenController struct{}
+
+// maxAPITokensPerUser limits how many active tokens a user can hold
+const maxAPITokensPerUser = 20
+
+// apiTokenResponse describes a token without its secret
+func apiTokenResponse(token *models.APIToken) gin.H {
+	return gin.H{
+		"id":           token.ID,
+		"name":         token.Name,
+		"prefix":       token.Prefix,
+		"scopes":       token.ScopeList(),
+		"expires_at":   token.ExpiresAt,
+		"last_used_at": token.LastUsedAt,
+		"created_at":   token.CreatedAt,
+	}
+}
+
+// GetTokens handles GET /profile/tokens
+func (atc *APITokenController) GetTokens(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	var tokens []models.APIToken
+	if err := database.DB.Where("user_id = ? AND revoked_at IS NULL", userID).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Order("created_at DESC").
+		Find(&tokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch API tokens",
+		})
+		return
+	}
+
+	response := make([]gin.H, len(tokens))
+	for i := range tokens {
+		response[i] = apiTokenResponse(&tokens[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tokens":       response,
+		"total_tokens": len(response),
+	})
+}
+
+// CreateToken handles POST /profile/tokens
+func (atc *APITokenController) CreateToken(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	var req struct {
+		Name      string   `json:"name" binding:"required,max=100"`
+		Scopes    []string `json:"scopes" binding:"required,min=1,dive,oneof=read submit admin"`
+		ExpiresIn string   `json:"expires_in"` // e.g. "720h"; empty for no expiry
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresIn != "" {
+		duration, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || duration <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "expires_in must be a positive duration such as 720h",
+			})
+			return
+		}
+		expiry := time.Now().Add(duration)
+		expiresAt = &expiry
+	}
+
+	var user models.User
+	if err := database.DB.Preload("Roles").First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	// Deduplicate scopes and keep admin access for staff only
+	scopes := []string{}
+	for _, scope := range models.ValidScopes {
+		for _, requested := range req.Scopes {
+			if requested == scope {
+				scopes = append(scopes, scope)
+				break
+			}
+		}
+	}
+	for _, scope := range scopes {
+		if scope == models.ScopeAdmin && !user.IsStaff() {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Only staff can create tokens with the admin scope",
+			})
+			return
+		}
+	}
+
+	var active int64
+	if err := database.DB.Model(&models.APIToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", user.ID).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Count(&active).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create API token",
+		})
+		return
+	}
+	if active >= maxAPITokensPerUser {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Too many active API tokens; revoke one first",
+		})
+		return
+	}
+
+	secret, err := utils.GenerateRandomToken(20)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create API token",
+		})
+		return
+	}
+	plaintext := models.APITokenPrefix + secret
+
+	token := models.APIToken{
+		UserID:       user.ID,
+		Name:         req.Name,
+		Prefix:       plaintext[:len(models.APITokenPrefix)+6],
+		TokenHash:    utils.HashToken(plaintext),
+		Scopes:       strings.Join(scopes, ","),
+		TokenVersion: user.TokenVersion,
+		MFAVerified:  c.GetBool("mfaVerified"),
+		ExpiresAt:    expiresAt,
+	}
+	if err := database.DB.Create(&token).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create API token",
+		})
+		return
+	}
+
+	response := apiTokenResponse(&token)
+	response["token"] = plaintext
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":   "API token created. Copy it now; it will not be shown again.",
+		"api_token": response,
+	})
+}
+
+// RevokeToken handles DELETE /profile/tokens/:id
+func (atc *APITokenController) RevokeToken(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	tokenID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid token ID",
+		})
+		return
+	}
+
+	result := database.DB.Model(&models.APIToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to revoke API token",
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "API token not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "API token revoked successfully",
+	})
+}
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thelostleo/CTF-backend/database"
+	"github.com/thelostleo/CTF-backend/models"
+	"gorm.io/gorm"
+)
+
+// CreateAward handles POST /admin/awards
+func (ac *AdminController) CreateAward(c *gin.Context) {
+	adminID, _ := c.Get("userID")
+
+	var req struct {
+		UserID *uint  `json:"user_id"`
+		TeamID *uint  `json:"team_id"`
+		Value  int    `json:"value" binding:"required"`
+		Reason string `json:"reason" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if req.UserID == nil && req.TeamID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Either user_id or team_id is required",
+		})
+		return
+	}
+
+	award := models.Award{
+		UserID:    req.UserID,
+		TeamID:    req.TeamID,
+		Value:     req.Value,
+		Reason:    req.Reason,
+		AwardedBy: adminID.(uint),
+	}
+
+	// Awards to a user also count for the team they are currently in
+	if req.UserID != nil {
+		var user models.User
+		if err := database.DB.First(&user, *req.UserID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "User not found",
+			})
+			return
+		}
+		if award.TeamID == nil {
+			award.TeamID = user.TeamID
+		}
+	}
+
+	if award.TeamID != nil {
+		var team models.Team
+		if err := database.DB.First(&team, *award.TeamID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Team not found",
+			})
+			return
+		}
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&award).Error; err != nil {
+			return err
+		}
+		if award.UserID != nil {
+			if err := syncUserScores(tx, *award.UserID); err != nil {
+				return err
+			}
+		}
+		if award.TeamID != nil {
+			return syncTeamScores(tx, *award.TeamID)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create award",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Award created successfully",
+		"award":   award,
+	})
+}
+
+// GetAwards handles GET /admin/awards
+func (ac *AdminController) GetAwards(c *gin.Context) {
+	var awards []models.Award
+
+	if err := database.DB.Order("created_at DESC").Find(&awards).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch awards",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"awards":       awards,
+		"total_awards": len(awards),
+	})
+}
+
+// DeleteAward handles DELETE /admin/awards/:id
+func (ac *AdminController) DeleteAward(c *gin.Context) {
+	id := c.Param("id")
+	awardID, err := strconv.Atoi(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid award ID",
+		})
+		return
+	}
+
+	var award models.Award
+	if err := database.DB.First(&award, awardID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Award not found",
+		})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&award).Error; err != nil {
+			return err
+		}
+		if award.UserID != nil {
+			if err := syncUserScores(tx, *award.UserID); err != nil {
+				return err
+			}
+		}
+		if award.TeamID != nil {
+			return syncTeamScores(tx, *award.TeamID)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to delete award",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Award deleted successfully",
+	})
+}
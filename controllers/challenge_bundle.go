@@ -0,0 +1,1156 @@
+package controllers
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thelostleo/CTF-backend/database"
+	"github.com/thelostleo/CTF-backend/models"
+	"github.com/thelostleo/CTF-backend/utils"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// bundleFileName is the challenge definition inside each bundle directory
+const bundleFileName = "challenge.yml"
+
+// maxBundleDefinitionSize caps the size of a single challenge.yml
+const maxBundleDefinitionSize = 1 << 20
+
+// maxImportSize returns the largest accepted bundle archive in bytes (MAX_IMPORT_SIZE_MB, default 500)
+func maxImportSize() int64 {
+	return int64(utils.GetEnvAsInt("MAX_IMPORT_SIZE_MB", 500)) << 20
+}
+
+// errDryRun rolls back an import that was only meant to report its changes
+var errDryRun = errors.New("dry run")
+
+var (
+	errInvalidSlug = errors.New("slug must be lowercase letters, digits, - and _")
+	errSlugTaken   = errors.New("slug is already used by another challenge")
+)
+
+// challengeSlug validates the requested slug of a challenge, or derives a free
+// one from the title when none is requested. excludeID is the challenge being
+// updated, if any.
+func challengeSlug(db *gorm.DB, requested, title string, excludeID uint) (string, error) {
+	taken := func(slug string) (bool, error) {
+		var count int64
+		err := db.Model(&models.Challenge{}).Where("slug = ? AND id <> ?", slug, excludeID).Count(&count).Error
+		return count > 0, err
+	}
+
+	if requested != "" {
+		if !models.SlugPattern.MatchString(requested) {
+			return "", errInvalidSlug
+		}
+		exists, err := taken(requested)
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			return "", errSlugTaken
+		}
+		return requested, nil
+	}
+
+	base := models.Slugify(title)
+	slug := base
+	for i := 2; ; i++ {
+		exists, err := taken(slug)
+		if err != nil || !exists {
+			return slug, err
+		}
+		slug = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// respondSlugError reports a slug problem from challengeSlug
+func respondSlugError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errInvalidSlug):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid slug",
+		})
+	case errors.Is(err, errSlugTaken):
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Slug is already used by another challenge",
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to check slug",
+		})
+	}
+}
+
+// bundleFlag is an accepted flag in a bundle; a plain string is a static flag
+type bundleFlag struct {
+	Content string `yaml:"content"`
+	Type    string `yaml:"type,omitempty"`
+}
+
+// UnmarshalYAML accepts either a string or a mapping
+func (f *bundleFlag) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		f.Content = value.Value
+		return nil
+	}
+	type plain bundleFlag
+	return value.Decode((*plain)(f))
+}
+
+// MarshalYAML writes static flags as plain strings
+func (f bundleFlag) MarshalYAML() (interface{}, error) {
+	if f.Type == "" || f.Type == models.FlagStatic {
+		return f.Content, nil
+	}
+	type plain bundleFlag
+	return plain(f), nil
+}
+
+// bundleHint is a hint in a bundle; a plain string is a free hint
+type bundleHint struct {
+	Content string `yaml:"content"`
+	Cost    int    `yaml:"cost,omitempty"`
+}
+
+// UnmarshalYAML accepts either a string or a mapping
+func (h *bundleHint) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		h.Content = value.Value
+		return nil
+	}
+	type plain bundleHint
+	return value.Decode((*plain)(h))
+}
+
+// MarshalYAML writes free hints as plain strings
+func (h bundleHint) MarshalYAML() (interface{}, error) {
+	if h.Cost == 0 {
+		return h.Content, nil
+	}
+	type plain bundleHint
+	return plain(h), nil
+}
+
+// bundlePrerequisite requires solving the challenge with a slug or scoring
+// points in a category; a plain string is a challenge slug
+type bundlePrerequisite struct {
+	Challenge string `yaml:"challenge,omitempty"`
+	Category  string `yaml:"category,omitempty"`
+	MinPoints int    `yaml:"min_points,omitempty"`
+}
+
+// UnmarshalYAML accepts either a string or a mapping
+func (p *bundlePrerequisite) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		p.Challenge = value.Value
+		return nil
+	}
+	type plain bundlePrerequisite
+	return value.Decode((*plain)(p))
+}
+
+// MarshalYAML writes challenge prerequisites as plain slugs
+func (p bundlePrerequisite) MarshalYAML() (interface{}, error) {
+	if p.Challenge != "" {
+		return p.Challenge, nil
+	}
+	type plain bundlePrerequisite
+	return plain(p), nil
+}
+
+// challengeBundle is the content of a challenge.yml. Files are paths relative
+// to the bundle directory.
+type challengeBundle struct {
+	Slug             string               `yaml:"slug"`
+	Title            string               `yaml:"title"`
+	Category         string               `yaml:"category"`
+	Difficulty       string               `yaml:"difficulty,omitempty"`
+	Description      string               `yaml:"description,omitempty"`
+	Points           int                  `yaml:"points"`
+	ScoringType      string               `yaml:"scoring_type,omitempty"`
+	InitialPoints    int                  `yaml:"initial_points,omitempty"`
+	MinimumPoints    int                  `yaml:"minimum_points,omitempty"`
+	Decay            int                  `yaml:"decay,omitempty"`
+	DecayFunction    string               `yaml:"decay_function,omitempty"`
+	IsActive         *bool                `yaml:"is_active,omitempty"`
+	FileURL          string               `yaml:"file_url,omitempty"`
+	LockedVisibility string               `yaml:"locked_visibility,omitempty"`
+	ReleaseAt        *time.Time           `yaml:"release_at,omitempty"`
+	HideAt           *time.Time           `yaml:"hide_at,omitempty"`
+	Tags             []string             `yaml:"tags,omitempty"`
+	Flags            []bundleFlag         `yaml:"flags"`
+	Hints            []bundleHint         `yaml:"hints,omitempty"`
+	Files            []string             `yaml:"files,omitempty"`
+	Prerequisites    []bundlePrerequisite `yaml:"prerequisites,omitempty"`
+
+	dir string // Directory of the challenge.yml inside the archive
+}
+
+// bundleChange reports what an import did (or would do) to one challenge
+type bundleChange struct {
+	Slug    string   `json:"slug"`
+	Action  string   `json:"action"` // create, update or unchanged
+	Changes []string `json:"changes,omitempty"`
+}
+
+// bundleImport applies bundles from an archive to the database
+type bundleImport struct {
+	tx       *gorm.DB
+	archive  map[string]*zip.File
+	storage  utils.Storage
+	dryRun   bool
+	authorID uint
+
+	stored  []string // Storage keys written, removed again if the import fails
+	removed []string // Storage keys to delete once the import is committed
+}
+
+// readBundles finds and parses every challenge.yml in the archive and checks
+// that the files they reference exist. All problems are reported at once.
+func readBundles(reader *zip.Reader) ([]challengeBundle, map[string]*zip.File, []string) {
+	archive := make(map[string]*zip.File)
+	for _, file := range reader.File {
+		if !file.FileInfo().IsDir() {
+			archive[path.Clean(file.Name)] = file
+		}
+	}
+
+	var bundles []challengeBundle
+	var problems []string
+	slugs := make(map[string]string)
+
+	names := make([]string, 0, len(archive))
+	for name := range archive {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if path.Base(name) != bundleFileName {
+			continue
+		}
+
+		bundle, err := parseBundle(archive[name])
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		bundle.dir = path.Dir(name)
+		if bundle.Slug == "" {
+			bundle.Slug = models.Slugify(bundle.Title)
+			if bundle.dir != "." {
+				bundle.Slug = models.Slugify(path.Base(bundle.dir))
+			}
+		}
+
+		for _, problem := range validateBundle(bundle, archive) {
+			problems = append(problems, fmt.Sprintf("%s: %s", name, problem))
+		}
+		if other, exists := slugs[bundle.Slug]; exists {
+			problems = append(problems, fmt.Sprintf("%s: slug %q is also used by %s", name, bundle.Slug, other))
+		}
+		slugs[bundle.Slug] = name
+		bundles = append(bundles, *bundle)
+	}
+
+	if len(bundles) == 0 && len(problems) == 0 {
+		problems = append(problems, "the archive contains no "+bundleFileName)
+	}
+	return bundles, archive, problems
+}
+
+// parseBundle decodes a challenge.yml, rejecting unknown keys
+func parseBundle(file *zip.File) (*challengeBundle, error) {
+	if file.UncompressedSize64 > maxBundleDefinitionSize {
+		return nil, errors.New("file is too large")
+	}
+	content, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	var bundle challengeBundle
+	decoder := yaml.NewDecoder(io.LimitReader(content, maxBundleDefinitionSize))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&bundle); err != nil {
+		return nil, err
+	}
+	return &bundle, nil
+}
+
+// bundleFilePath resolves a file referenced by a bundle to its archive path,
+// refusing paths that leave the bundle directory
+func bundleFilePath(bundle *challengeBundle, name string) (string, bool) {
+	resolved := path.Clean(path.Join(bundle.dir, name))
+	if path.IsAbs(name) || resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return "", false
+	}
+	if bundle.dir != "." && !strings.HasPrefix(resolved, bundle.dir+"/") {
+		return "", false
+	}
+	return resolved, true
+}
+
+// validateBundle checks a bundle without touching the database
+func validateBundle(bundle *challengeBundle, archive map[string]*zip.File) []string {
+	var problems []string
+	if !models.SlugPattern.MatchString(bundle.Slug) {
+		problems = append(problems, fmt.Sprintf("slug %q must be lowercase letters, digits, - and _", bundle.Slug))
+	}
+	if bundle.Title == "" || bundle.Category == "" {
+		problems = append(problems, "title and category are required")
+	}
+	if !models.ValidDifficulty(bundle.Difficulty) {
+		problems = append(problems, "difficulty must be easy, medium, hard or insane")
+	}
+	if bundle.Points < 1 && bundle.InitialPoints < 1 {
+		problems = append(problems, "points must be at least 1")
+	}
+	switch bundle.LockedVisibility {
+	case "", models.LockedHidden, models.LockedShown:
+	default:
+		problems = append(problems, "locked_visibility must be hidden or locked")
+	}
+	if bundle.ReleaseAt != nil && bundle.HideAt != nil && !bundle.HideAt.After(*bundle.ReleaseAt) {
+		problems = append(problems, "hide_at must be after release_at")
+	}
+
+	if len(bundle.Flags) == 0 {
+		problems = append(problems, "at least one flag is required")
+	}
+	for _, flag := range bundle.Flags {
+		candidate := models.ChallengeFlag{Content: flag.Content, Type: flag.Type}
+		if err := candidate.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("flag: %v", err))
+		}
+		if flag.Content == "" || (utils.IsSealedFlag(flag.Content) && !utils.IsHashedFlag(flag.Content)) {
+			problems = append(problems, "flags must be plaintext or exported hashes")
+		}
+	}
+	for _, hint := range bundle.Hints {
+		if hint.Content == "" || hint.Cost < 0 {
+			problems = append(problems, "hints need content and a cost of at least 0")
+		}
+	}
+
+	// Uploads may share a name, so only the archive paths must be unique
+	listed := make(map[string]bool)
+	for _, name := range bundle.Files {
+		resolved, ok := bundleFilePath(bundle, name)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("file %q is outside the bundle directory", name))
+			continue
+		}
+		if listed[resolved] {
+			problems = append(problems, fmt.Sprintf("file %q is listed more than once", name))
+			continue
+		}
+		listed[resolved] = true
+		file, exists := archive[resolved]
+		if !exists {
+			problems = append(problems, fmt.Sprintf("file %q is missing from the archive", name))
+			continue
+		}
+		if int64(file.UncompressedSize64) > maxUploadSize() {
+			problems = append(problems, fmt.Sprintf("file %q is too large", name))
+		}
+	}
+
+	for _, prerequisite := range bundle.Prerequisites {
+		switch {
+		case prerequisite.Challenge != "" && prerequisite.Category == "":
+			if prerequisite.Challenge == bundle.Slug {
+				problems = append(problems, "a challenge cannot require itself")
+			}
+		case prerequisite.Challenge == "" && prerequisite.Category != "" && prerequisite.MinPoints > 0:
+		default:
+			problems = append(problems, "prerequisites need either a challenge slug or a category with positive min_points")
+		}
+	}
+	return problems
+}
+
+// applyBundles creates or updates the challenge of every bundle, then links
+// prerequisites once every slug can be resolved
+func (bi *bundleImport) applyBundles(bundles []challengeBundle) ([]bundleChange, error) {
+	changes := make([]bundleChange, len(bundles))
+	challengeIDs := make([]uint, len(bundles))
+	for i := range bundles {
+		change, challengeID, err := bi.applyBundle(&bundles[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", bundles[i].Slug, err)
+		}
+		changes[i] = *change
+		challengeIDs[i] = challengeID
+	}
+
+	for i := range bundles {
+		changed, err := bi.applyPrerequisites(&bundles[i], challengeIDs[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", bundles[i].Slug, err)
+		}
+		if changed {
+			changes[i].Changes = append(changes[i].Changes, "prerequisites")
+			if changes[i].Action == "unchanged" {
+				changes[i].Action = "update"
+			}
+		}
+	}
+
+	// The graph is checked as a whole, since bundles may reference each other
+	graph, err := prerequisiteGraph(bi.tx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range bundles {
+		if cycle := findPrerequisiteCycle(graph, challengeIDs[i]); cycle != nil {
+			return nil, &bundleError{fmt.Sprintf("%s: prerequisites create a cycle: %s", bundles[i].Slug, formatCycle(cycle))}
+		}
+		for _, prerequisite := range bundles[i].Prerequisites {
+			if prerequisite.Category == "" {
+				continue
+			}
+			reachable, err := reachableCategoryPoints(bi.tx, graph, challengeIDs[i], prerequisite.Category)
+			if err != nil {
+				return nil, err
+			}
+			if reachable < prerequisite.MinPoints {
+				return nil, &bundleError{fmt.Sprintf("%s: only %d points in category %q can be earned before it unlocks",
+					bundles[i].Slug, reachable, prerequisite.Category)}
+			}
+		}
+	}
+
+	// Points requirements can still deadlock through other categories
+	challenges, err := loadUnlockGraph(bi.tx)
+	if err != nil {
+		return nil, err
+	}
+	unlocked := unlockable(challenges)
+	for i := range bundles {
+		if !unlocked[challengeIDs[i]] {
+			return nil, &bundleError{fmt.Sprintf("%s: prerequisites can never be met: the challenges they need to be solved first are locked behind it", bundles[i].Slug)}
+		}
+	}
+	return changes, nil
+}
+
+// bundleError is an import problem caused by the bundles rather than the server
+type bundleError struct {
+	message string
+}
+
+func (e *bundleError) Error() string {
+	return e.message
+}
+
+// bundleChallenge builds the challenge fields described by a bundle
+func bundleChallenge(bundle *challengeBundle) (*models.Challenge, error) {
+	isActive := true
+	if bundle.IsActive != nil {
+		isActive = *bundle.IsActive
+	}
+	lockedVisibility := bundle.LockedVisibility
+	if lockedVisibility == "" {
+		lockedVisibility = models.LockedHidden
+	}
+
+	challenge := &models.Challenge{
+		Slug:             bundle.Slug,
+		Title:            bundle.Title,
+		Category:         bundle.Category,
+		Difficulty:       bundle.Difficulty,
+		Description:      bundle.Description,
+		Points:           bundle.Points,
+		ScoringType:      bundle.ScoringType,
+		InitialPoints:    bundle.InitialPoints,
+		MinimumPoints:    bundle.MinimumPoints,
+		Decay:            bundle.Decay,
+		DecayFunction:    bundle.DecayFunction,
+		IsActive:         isActive,
+		FileURL:          bundle.FileURL,
+		LockedVisibility: lockedVisibility,
+		ReleaseAt:        bundle.ReleaseAt,
+		HideAt:           bundle.HideAt,
+	}
+	if err := validateScoring(challenge); err != nil {
+		return nil, &bundleError{err.Error()}
+	}
+	if challenge.IsDynamic() {
+		challenge.Points = challenge.InitialPoints
+	}
+	return challenge, nil
+}
+
+// sameTime reports whether two optional times are equal
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Equal(*b)
+}
+
+// applyBundle creates or updates one challenge with its flags, hints, tags and files
+func (bi *bundleImport) applyBundle(bundle *challengeBundle) (*bundleChange, uint, error) {
+	target, err := bundleChallenge(bundle)
+	if err != nil {
+		return nil, 0, err
+	}
+	change := &bundleChange{Slug: bundle.Slug, Action: "unchanged"}
+
+	var existing models.Challenge
+	err = bi.tx.Preload("Flags").
+		Preload("Hints", orderHints).
+		Preload("Files", orderFiles).
+		Preload("Tags").
+		Where("slug = ?", bundle.Slug).
+		First(&existing).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		target.AuthorID = &bi.authorID
+		if err := bi.tx.Create(target).Error; err != nil {
+			return nil, 0, err
+		}
+		existing = *target
+		change.Action = "create"
+	case err != nil:
+		return nil, 0, err
+	default:
+		updates := map[string]interface{}{}
+		compare := func(name string, equal bool, value interface{}) {
+			if !equal {
+				updates[name] = value
+				change.Changes = append(change.Changes, name)
+			}
+		}
+		compare("title", existing.Title == target.Title, target.Title)
+		compare("category", existing.Category == target.Category, target.Category)
+		compare("difficulty", existing.Difficulty == target.Difficulty, target.Difficulty)
+		compare("description", existing.Description == target.Description, target.Description)
+		compare("scoring_type", existing.ScoringType == target.ScoringType, target.ScoringType)
+		compare("initial_points", existing.InitialPoints == target.InitialPoints, target.InitialPoints)
+		compare("minimum_points", existing.MinimumPoints == target.MinimumPoints, target.MinimumPoints)
+		compare("decay", existing.Decay == target.Decay, target.Decay)
+		compare("decay_function", existing.DecayFunction == target.DecayFunction, target.DecayFunction)
+		compare("is_active", existing.IsActive == target.IsActive, target.IsActive)
+		compare("file_url", existing.FileURL == target.FileURL, target.FileURL)
+		compare("locked_visibility", existing.LockedVisibility == target.LockedVisibility, target.LockedVisibility)
+		compare("release_at", sameTime(existing.ReleaseAt, target.ReleaseAt), target.ReleaseAt)
+		compare("hide_at", sameTime(existing.HideAt, target.HideAt), target.HideAt)
+		// The value of a dynamic challenge is derived from its solves
+		if !target.IsDynamic() {
+			compare("points", existing.Points == target.Points, target.Points)
+		}
+
+		if len(updates) > 0 {
+			if err := bi.tx.Model(&existing).Updates(updates).Error; err != nil {
+				return nil, 0, err
+			}
+			if err := bi.tx.First(&existing, existing.ID).Error; err != nil {
+				return nil, 0, err
+			}
+			if err := recalculateChallengeValue(bi.tx, &existing); err != nil {
+				return nil, 0, err
+			}
+			if err := syncSolverScores(bi.tx, existing.ID); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+
+	steps := []struct {
+		name  string
+		apply func(*challengeBundle, *models.Challenge) (bool, error)
+	}{
+		{"flags", bi.applyFlags},
+		{"hints", bi.applyHints},
+		{"tags", bi.applyTags},
+		{"files", bi.applyFiles},
+	}
+	for _, step := range steps {
+		changed, err := step.apply(bundle, &existing)
+		if err != nil {
+			return nil, 0, err
+		}
+		if changed && change.Action != "create" {
+			change.Changes = append(change.Changes, step.name)
+		}
+	}
+	if change.Action == "unchanged" && len(change.Changes) > 0 {
+		change.Action = "update"
+	}
+	return change, existing.ID, nil
+}
+
+// flagMatches reports whether a stored flag is the bundle flag
+func flagMatches(stored *models.ChallengeFlag, flag bundleFlag) bool {
+	flagType := flag.Type
+	if flagType == "" {
+		flagType = models.FlagStatic
+	}
+	if stored.Type != flagType {
+		return false
+	}
+	if stored.Content == flag.Content {
+		return true
+	}
+	if utils.IsHashedFlag(stored.Content) {
+		content := flag.Content
+		if flagType == models.FlagCaseInsensitive {
+			content = strings.ToLower(content)
+		}
+		return utils.VerifyHashedFlag(stored.Content, content)
+	}
+	plaintext, err := stored.Plaintext()
+	return err == nil && plaintext == flag.Content
+}
+
+// applyFlags replaces the flags unless they already match the bundle
+func (bi *bundleImport) applyFlags(bundle *challengeBundle, challenge *models.Challenge) (bool, error) {
+	if len(challenge.Flags) == len(bundle.Flags) {
+		matched := make([]bool, len(challenge.Flags))
+		same := true
+		for _, flag := range bundle.Flags {
+			found := false
+			for i := range challenge.Flags {
+				if !matched[i] && flagMatches(&challenge.Flags[i], flag) {
+					matched[i] = true
+					found = true
+					break
+				}
+			}
+			if !found {
+				same = false
+				break
+			}
+		}
+		if same {
+			return false, nil
+		}
+	}
+
+	flags := make([]models.ChallengeFlag, len(bundle.Flags))
+	for i, flag := range bundle.Flags {
+		flags[i] = models.ChallengeFlag{Content: flag.Content, Type: flag.Type}
+		if err := flags[i].Validate(); err != nil {
+			return false, &bundleError{err.Error()}
+		}
+	}
+	return true, replaceFlags(bi.tx, challenge.ID, flags)
+}
+
+// applyHints updates hints in place by position so existing unlocks keep pointing at them
+func (bi *bundleImport) applyHints(bundle *challengeBundle, challenge *models.Challenge) (bool, error) {
+	changed := false
+	for i, hint := range bundle.Hints {
+		if i < len(challenge.Hints) {
+			existing := &challenge.Hints[i]
+			if existing.Content == hint.Content && existing.Cost == hint.Cost && existing.Position == i {
+				continue
+			}
+			if err := bi.tx.Model(existing).Updates(map[string]interface{}{
+				"content":  hint.Content,
+				"cost":     hint.Cost,
+				"position": i,
+			}).Error; err != nil {
+				return false, err
+			}
+		} else if err := bi.tx.Create(&models.Hint{
+			ChallengeID: challenge.ID,
+			Content:     hint.Content,
+			Cost:        hint.Cost,
+			Position:    i,
+		}).Error; err != nil {
+			return false, err
+		}
+		changed = true
+	}
+
+	for i := len(bundle.Hints); i < len(challenge.Hints); i++ {
+		if err := bi.tx.Delete(&challenge.Hints[i]).Error; err != nil {
+			return false, err
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// findOrCreateTags returns the tags with the given names, creating missing ones
+func findOrCreateTags(tx *gorm.DB, names []string) ([]models.Tag, error) {
+	tags := []models.Tag{}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = models.NormalizeTagName(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		tag := models.Tag{Name: name}
+		if err := tx.Where("name = ?", name).FirstOrCreate(&tag).Error; err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// tagNames returns the sorted names of tags
+func tagNames(tags []models.Tag) []string {
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyTags replaces the tags unless they already match the bundle
+func (bi *bundleImport) applyTags(bundle *challengeBundle, challenge *models.Challenge) (bool, error) {
+	tags, err := findOrCreateTags(bi.tx, bundle.Tags)
+	if err != nil {
+		return false, err
+	}
+	if strings.Join(tagNames(tags), ",") == strings.Join(tagNames(challenge.Tags), ",") {
+		return false, nil
+	}
+	return true, bi.tx.Model(challenge).Association("Tags").Replace(tags)
+}
+
+// hashArchiveFile returns the SHA-256 of a file in the archive
+func hashArchiveFile(file *zip.File) (string, error) {
+	content, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.LimitReader(content, maxUploadSize()+1)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// applyFiles uploads new or changed files and removes files no longer listed.
+// Files are matched by name and checksum, so unchanged files are not uploaded again.
+func (bi *bundleImport) applyFiles(bundle *challengeBundle, challenge *models.Challenge) (bool, error) {
+	kept := make(map[uint]bool)
+	changed := false
+
+	for _, name := range bundle.Files {
+		resolved, _ := bundleFilePath(bundle, name)
+		archived := bi.archive[resolved]
+		checksum, err := hashArchiveFile(archived)
+		if err != nil {
+			return false, err
+		}
+
+		found := false
+		for _, file := range challenge.Files {
+			if !kept[file.ID] && file.Name == path.Base(resolved) && file.SHA256 == checksum {
+				kept[file.ID] = true
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+
+		changed = true
+		if bi.dryRun {
+			continue
+		}
+		file, err := bi.storeArchiveFile(challenge.ID, archived, path.Base(resolved), checksum)
+		if err != nil {
+			return false, err
+		}
+		if err := bi.tx.Create(file).Error; err != nil {
+			return false, err
+		}
+	}
+
+	for _, file := range challenge.Files {
+		if kept[file.ID] {
+			continue
+		}
+		changed = true
+		if err := bi.tx.Delete(&file).Error; err != nil {
+			return false, err
+		}
+		bi.removed = append(bi.removed, file.StorageKey)
+	}
+	return changed, nil
+}
+
+// storeArchiveFile uploads a file from the archive to storage
+func (bi *bundleImport) storeArchiveFile(challengeID uint, archived *zip.File, name, checksum string) (*models.ChallengeFile, error) {
+	content, err := archived.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	key, err := fileStorageKey(challengeID, name)
+	if err != nil {
+		return nil, err
+	}
+	contentType := mime.TypeByExtension(path.Ext(name))
+	size := int64(archived.UncompressedSize64)
+	if err := bi.storage.Put(key, io.LimitReader(content, size), size, contentType); err != nil {
+		return nil, err
+	}
+	bi.stored = append(bi.stored, key)
+
+	return &models.ChallengeFile{
+		ChallengeID: challengeID,
+		Name:        name,
+		StorageKey:  key,
+		Size:        size,
+		ContentType: contentType,
+		SHA256:      checksum,
+		UploadedBy:  &bi.authorID,
+	}, nil
+}
+
+// applyPrerequisites replaces the prerequisites unless they already match the bundle
+func (bi *bundleImport) applyPrerequisites(bundle *challengeBundle, challengeID uint) (bool, error) {
+	prerequisites := make([]models.ChallengePrerequisite, 0, len(bundle.Prerequisites))
+	for _, required := range bundle.Prerequisites {
+		prerequisite := models.ChallengePrerequisite{
+			ChallengeID: challengeID,
+			Type:        models.PrerequisiteCategoryPoints,
+			Category:    required.Category,
+			MinPoints:   required.MinPoints,
+		}
+		if required.Challenge != "" {
+			var requiredChallenge models.Challenge
+			if err := bi.tx.Select("id").Where("slug = ?", required.Challenge).First(&requiredChallenge).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return false, &bundleError{fmt.Sprintf("required challenge %q does not exist", required.Challenge)}
+				}
+				return false, err
+			}
+			prerequisite.Type = models.PrerequisiteChallenge
+			prerequisite.RequiredChallengeID = &requiredChallenge.ID
+		}
+		if err := prerequisite.Validate(); err != nil {
+			return false, &bundleError{err.Error()}
+		}
+		prerequisites = append(prerequisites, prerequisite)
+	}
+
+	var existing []models.ChallengePrerequisite
+	if err := bi.tx.Where("challenge_id = ?", challengeID).Find(&existing).Error; err != nil {
+		return false, err
+	}
+	if prerequisiteKeys(existing) == prerequisiteKeys(prerequisites) {
+		return false, nil
+	}
+
+	if err := bi.tx.Where("challenge_id = ?", challengeID).Delete(&models.ChallengePrerequisite{}).Error; err != nil {
+		return false, err
+	}
+	if len(prerequisites) == 0 {
+		return true, nil
+	}
+	return true, bi.tx.Create(&prerequisites).Error
+}
+
+// prerequisiteKeys describes a prerequisite set independent of order and IDs
+func prerequisiteKeys(prerequisites []models.ChallengePrerequisite) string {
+	keys := make([]string, len(prerequisites))
+	for i, prerequisite := range prerequisites {
+		requiredID := uint(0)
+		if prerequisite.RequiredChallengeID != nil {
+			requiredID = *prerequisite.RequiredChallengeID
+		}
+		keys[i] = fmt.Sprintf("%s:%d:%s:%d", prerequisite.Type, requiredID, prerequisite.Category, prerequisite.MinPoints)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+// cleanup removes files stored by an import that did not commit
+func (bi *bundleImport) cleanup() {
+	for _, key := range bi.stored {
+		if err := bi.storage.Delete(key); err != nil {
+			log.Printf("Failed to remove stored file %s: %v", key, err)
+		}
+	}
+}
+
+// finish deletes files of a committed import that are no longer referenced
+func (bi *bundleImport) finish() {
+	for _, key := range bi.removed {
+		if err := bi.storage.Delete(key); err != nil {
+			log.Printf("Failed to remove stored file %s: %v", key, err)
+		}
+	}
+}
+
+// exportFilePaths returns the path of every file of a challenge relative to
+// its bundle directory. Files are stored under files/; files sharing the name
+// of an earlier one go under files/<id>/ so every path is unique.
+func exportFilePaths(files []models.ChallengeFile) []string {
+	paths := make([]string, len(files))
+	taken := make(map[string]bool, len(files))
+	for i, file := range files {
+		paths[i] = "files/" + file.Name
+		if taken[file.Name] {
+			paths[i] = fmt.Sprintf("files/%d/%s", file.ID, file.Name)
+		}
+		taken[file.Name] = true
+	}
+	return paths
+}
+
+// exportBundle describes a challenge as a bundle; files are listed under files/
+func exportBundle(challenge *models.Challenge, slugs map[uint]string) challengeBundle {
+	isActive := challenge.IsActive
+	bundle := challengeBundle{
+		Slug:             challenge.Slug,
+		Title:            challenge.Title,
+		Category:         challenge.Category,
+		Difficulty:       challenge.Difficulty,
+		Description:      challenge.Description,
+		Points:           challenge.Points,
+		IsActive:         &isActive,
+		FileURL:          challenge.FileURL,
+		LockedVisibility: challenge.LockedVisibility,
+		ReleaseAt:        challenge.ReleaseAt,
+		HideAt:           challenge.HideAt,
+		Tags:             tagNames(challenge.Tags),
+	}
+	if challenge.IsDynamic() {
+		bundle.Points = challenge.InitialPoints
+		bundle.ScoringType = challenge.ScoringType
+		bundle.InitialPoints = challenge.InitialPoints
+		bundle.MinimumPoints = challenge.MinimumPoints
+		bundle.Decay = challenge.Decay
+		bundle.DecayFunction = challenge.DecayFunction
+	}
+
+	for _, flag := range challenge.Flags {
+		// Hashed flags cannot be reversed and are exported as their hash
+		content, err := flag.Plaintext()
+		if err != nil {
+			content = flag.Content
+		}
+		bundle.Flags = append(bundle.Flags, bundleFlag{Content: content, Type: flag.Type})
+	}
+	for _, hint := range challenge.Hints {
+		bundle.Hints = append(bundle.Hints, bundleHint{Content: hint.Content, Cost: hint.Cost})
+	}
+	bundle.Files = append(bundle.Files, exportFilePaths(challenge.Files)...)
+	for _, prerequisite := range challenge.Prerequisites {
+		if prerequisite.Type == models.PrerequisiteChallenge {
+			slug, ok := slugs[*prerequisite.RequiredChallengeID]
+			if !ok {
+				continue
+			}
+			bundle.Prerequisites = append(bundle.Prerequisites, bundlePrerequisite{Challenge: slug})
+			continue
+		}
+		bundle.Prerequisites = append(bundle.Prerequisites, bundlePrerequisite{
+			Category:  prerequisite.Category,
+			MinPoints: prerequisite.MinPoints,
+		})
+	}
+	return bundle
+}
+
+// writeBundles writes every challenge as <slug>/challenge.yml plus its files to the archive
+func writeBundles(archive *zip.Writer, challenges []models.Challenge, storage utils.Storage) error {
+	slugs := make(map[uint]string, len(challenges))
+	for _, challenge := range challenges {
+		slugs[challenge.ID] = challenge.Slug
+	}
+
+	for i := range challenges {
+		challenge := &challenges[i]
+		definition, err := yaml.Marshal(exportBundle(challenge, slugs))
+		if err != nil {
+			return err
+		}
+		writer, err := archive.Create(challenge.Slug + "/" + bundleFileName)
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(definition); err != nil {
+			return err
+		}
+
+		for j, filePath := range exportFilePaths(challenge.Files) {
+			if err := writeArchiveFile(archive, storage, challenge.Slug+"/"+filePath, &challenge.Files[j]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeArchiveFile copies a stored file into the archive
+func writeArchiveFile(archive *zip.Writer, storage utils.Storage, name string, file *models.ChallengeFile) error {
+	content, err := storage.Open(file.StorageKey)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	writer, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, content)
+	return err
+}
+
+// ImportChallenges handles POST /admin/challenges/import. The upload is a zip
+// of bundle directories, each with a challenge.yml; challenges are matched by
+// slug so importing the same archive twice changes nothing. With
+// ?dry_run=true the changes are reported but not applied.
+func (ac *AdminController) ImportChallenges(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true"
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize())
+	header, err := c.FormFile("bundle")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid upload; send multipart/form-data with a \"bundle\" zip file",
+			"details": err.Error(),
+		})
+		return
+	}
+	upload, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to read bundle",
+		})
+		return
+	}
+	defer upload.Close()
+
+	reader, err := zip.NewReader(upload, header.Size)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Bundle is not a valid zip archive",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	bundles, archive, problems := readBundles(reader)
+	if len(problems) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Invalid bundle",
+			"problems": problems,
+		})
+		return
+	}
+
+	importer := &bundleImport{
+		archive:  archive,
+		storage:  utils.GetStorage(),
+		dryRun:   dryRun,
+		authorID: c.GetUint("userID"),
+	}
+	var changes []bundleChange
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Serialize graph edits so an import cannot form a cycle with a concurrent change
+		if err := tx.Exec("LOCK TABLE challenge_prerequisites IN SHARE ROW EXCLUSIVE MODE").Error; err != nil {
+			return err
+		}
+
+		importer.tx = tx
+		var err error
+		changes, err = importer.applyBundles(bundles)
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+
+	var invalid *bundleError
+	switch {
+	case errors.Is(err, errDryRun):
+	case errors.As(err, &invalid):
+		importer.cleanup()
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Invalid bundle",
+			"problems": []string{invalid.Error()},
+		})
+		return
+	case err != nil:
+		importer.cleanup()
+		log.Printf("Failed to import challenges: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to import challenges",
+		})
+		return
+	default:
+		importer.finish()
+	}
+
+	message := "Challenges imported successfully"
+	if dryRun {
+		message = "Dry run; no changes were made"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":    message,
+		"dry_run":    dryRun,
+		"challenges": changes,
+	})
+}
+
+// ExportChallenges handles GET /admin/challenges/export. It streams every
+// challenge as a zip in the bundle format accepted by ImportChallenges.
+func (ac *AdminController) ExportChallenges(c *gin.Context) {
+	var challenges []models.Challenge
+	if err := database.DB.Preload("Flags").
+		Preload("Hints", orderHints).
+		Preload("Files", orderFiles).
+		Preload("Tags").
+		Preload("Prerequisites").
+		Order("id ASC").
+		Find(&challenges).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch challenges",
+		})
+		return
+	}
+
+	name := fmt.Sprintf("challenges-%s.zip", time.Now().UTC().Format("20060102-150405"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	c.Status(http.StatusOK)
+
+	// The response is already under way, so failures can only be logged
+	archive := zip.NewWriter(c.Writer)
+	if err := writeBundles(archive, challenges, utils.GetStorage()); err != nil {
+		log.Printf("Failed to export challenges: %v", err)
+		return
+	}
+	if err := archive.Close(); err != nil {
+		log.Printf("Failed to export challenges: %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/thelostleo/CTF-backend/models"
+	"github.com/thelostleo/CTF-backend/utils"
+)
+
+// zipOf builds an archive from file names and contents
+func zipOf(t *testing.T, files map[string]string) *zip.Reader {
+	t.Helper()
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	for name, content := range files {
+		writer, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writer.Write([]byte(content))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reader
+}
+
+// bundleYAML returns a minimal challenge.yml with extra lines appended
+func bundleYAML(slug string, extra ...string) string {
+	lines := append([]string{
+		"slug: " + slug,
+		"title: " + slug,
+		"category: misc",
+		"points: 100",
+		"flags: [\"flag{" + slug + "}\"]",
+	}, extra...)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func TestBundleFilePath(t *testing.T) {
+	tests := []struct {
+		dir, name, resolved string
+		ok                  bool
+	}{
+		{dir: "web", name: "files/app.zip", resolved: "web/files/app.zip", ok: true},
+		{dir: "web", name: "./files/../app.zip", resolved: "web/app.zip", ok: true},
+		{dir: ".", name: "app.zip", resolved: "app.zip", ok: true},
+		{dir: "web", name: "../crypto/key.pem"},
+		{dir: "web", name: "files/../../secret"},
+		{dir: "web", name: "/etc/passwd"},
+		{dir: ".", name: "../outside"},
+		{dir: "web", name: ".."},
+	}
+	for _, tt := range tests {
+		resolved, ok := bundleFilePath(&challengeBundle{dir: tt.dir}, tt.name)
+		if ok != tt.ok || resolved != tt.resolved {
+			t.Errorf("bundleFilePath(%q, %q) = %q, %v; want %q, %v", tt.dir, tt.name, resolved, ok, tt.resolved, tt.ok)
+		}
+	}
+}
+
+func TestReadBundles(t *testing.T) {
+	reader := zipOf(t, map[string]string{
+		"web/challenge.yml":      bundleYAML("web", "files: [files/app.zip]", "prerequisites: [{challenge: crypto}]"),
+		"web/files/app.zip":      "zip",
+		"crypto/challenge.yml":   bundleYAML("crypto", "prerequisites: [{category: web, min_points: 100}]"),
+		"unrelated/readme.txt":   "ignored",
+		"nested/x/challenge.yml": bundleYAML("nested"),
+	})
+	bundles, archive, problems := readBundles(reader)
+	if len(problems) != 0 {
+		t.Fatalf("unexpected problems %v", problems)
+	}
+	if len(bundles) != 3 {
+		t.Fatalf("want 3 bundles, got %d", len(bundles))
+	}
+	if bundles[0].Slug != "crypto" || bundles[2].Slug != "web" || bundles[2].dir != "web" {
+		t.Fatalf("want bundles sorted by path with their directory, got %+v", bundles)
+	}
+	if _, ok := archive["web/files/app.zip"]; !ok {
+		t.Fatalf("archive is missing the bundle file")
+	}
+}
+
+func TestReadBundlesProblems(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		problem string
+	}{
+		{
+			name:    "no bundle",
+			files:   map[string]string{"readme.txt": "x"},
+			problem: "contains no challenge.yml",
+		},
+		{
+			name: "traversal",
+			files: map[string]string{
+				"web/challenge.yml": bundleYAML("web", "files: [../crypto/key.pem]"),
+				"crypto/key.pem":    "secret",
+			},
+			problem: "outside the bundle directory",
+		},
+		{
+			name:    "absolute path",
+			files:   map[string]string{"web/challenge.yml": bundleYAML("web", "files: [/etc/passwd]")},
+			problem: "outside the bundle directory",
+		},
+		{
+			name:    "missing file",
+			files:   map[string]string{"web/challenge.yml": bundleYAML("web", "files: [files/app.zip]")},
+			problem: "missing from the archive",
+		},
+		{
+			name: "slug collision",
+			files: map[string]string{
+				"a/challenge.yml": bundleYAML("same"),
+				"b/challenge.yml": bundleYAML("same"),
+			},
+			problem: `slug "same" is also used by a/challenge.yml`,
+		},
+		{
+			name: "derived slug collision",
+			files: map[string]string{
+				"web/challenge.yml":   "title: One\ncategory: misc\npoints: 1\nflags: [\"flag{a}\"]\n",
+				"x/web/challenge.yml": "title: Two\ncategory: misc\npoints: 1\nflags: [\"flag{b}\"]\n",
+			},
+			problem: `slug "web" is also used`,
+		},
+		{
+			name:    "unknown key",
+			files:   map[string]string{"web/challenge.yml": bundleYAML("web", "flagz: []")},
+			problem: "field flagz not found",
+		},
+		{
+			name:    "invalid slug",
+			files:   map[string]string{"web/challenge.yml": bundleYAML("Web App")},
+			problem: "must be lowercase letters",
+		},
+		{
+			name:    "self prerequisite",
+			files:   map[string]string{"web/challenge.yml": bundleYAML("web", "prerequisites: [{challenge: web}]")},
+			problem: "cannot require itself",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, problems := readBundles(zipOf(t, tt.files))
+			if !strings.Contains(strings.Join(problems, "\n"), tt.problem) {
+				t.Fatalf("want a problem containing %q, got %v", tt.problem, problems)
+			}
+		})
+	}
+}
+
+func TestValidateBundleFiles(t *testing.T) {
+	archive := map[string]*zip.File{}
+	for _, file := range zipOf(t, map[string]string{"web/a/app.zip": "1", "web/b/app.zip": "2"}).File {
+		archive[file.Name] = file
+	}
+	bundle := &challengeBundle{
+		Slug:     "web",
+		Title:    "Web",
+		Category: "web",
+		Points:   100,
+		Flags:    []bundleFlag{{Content: "flag{web}", Type: models.FlagStatic}},
+		dir:      "web",
+	}
+
+	// Files may share a name as long as their archive paths differ
+	bundle.Files = []string{"a/app.zip", "b/app.zip"}
+	if problems := validateBundle(bundle, archive); len(problems) != 0 {
+		t.Fatalf("unexpected problems %v", problems)
+	}
+
+	bundle.Files = []string{"a/app.zip", "./a/app.zip"}
+	if problems := validateBundle(bundle, archive); len(problems) != 1 || !strings.Contains(problems[0], "listed more than once") {
+		t.Fatalf("want the repeated file to be reported, got %v", problems)
+	}
+}
+
+func TestExportedBundlesImportAgain(t *testing.T) {
+	storage := &utils.LocalStorage{Dir: t.TempDir()}
+	for key, content := range map[string]string{"k1": "first", "k2": "second", "k3": "other"} {
+		if err := storage.Put(key, strings.NewReader(content), int64(len(content)), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	challenges := []models.Challenge{{
+		ID:       1,
+		Slug:     "web",
+		Title:    "Web",
+		Category: "web",
+		Points:   100,
+		IsActive: true,
+		Flags:    []models.ChallengeFlag{{Content: "flag{web}", Type: models.FlagStatic}},
+		Files: []models.ChallengeFile{
+			{ID: 10, Name: "app.zip", StorageKey: "k1"},
+			{ID: 11, Name: "app.zip", StorageKey: "k2"},
+			{ID: 12, Name: "notes.txt", StorageKey: "k3"},
+		},
+	}}
+
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	if err := writeBundles(archive, challenges, storage); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	archive.Close()
+
+	reader, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundles, _, problems := readBundles(reader)
+	if len(problems) != 0 {
+		t.Fatalf("re-import problems %v", problems)
+	}
+	want := []string{"files/app.zip", "files/11/app.zip", "files/notes.txt"}
+	if strings.Join(bundles[0].Files, ",") != strings.Join(want, ",") {
+		t.Fatalf("want files %v, got %v", want, bundles[0].Files)
+	}
+}
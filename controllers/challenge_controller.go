@@ -1,24 +1,97 @@
 package controllers
 
 import (
+	"crypto/subtle"
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/thelostleo/CTF-backend/database"
 	"github.com/thelostleo/CTF-backend/models"
+	"github.com/thelostleo/CTF-backend/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ChallengeController struct{}
 
-// GetAllChallenges handles GET /challenges
+// publicChallengeColumns are the challenge columns that are safe to show to players
+const publicChallengeColumns = "id, title, description, category, points, scoring_type, initial_points, minimum_points, decay, decay_function, is_active, file_url, release_at, hide_at, locked_visibility, slug, difficulty, created_at"
+
+var (
+	// errAlreadySolved is returned when the user or their team already solved a challenge
+	errAlreadySolved = errors.New("challenge already solved")
+	// errInsufficientPoints is returned when a hint costs more than the current score
+	errInsufficientPoints = errors.New("insufficient points")
+)
+
+// orderHints preloads hints in their display order
+func orderHints(db *gorm.DB) *gorm.DB {
+	return db.Order("position ASC, id ASC")
+}
+
+// GetAllChallenges handles GET /challenges. It supports filtering by
+// category, tag, difficulty, solved, min_points, max_points and search,
+// sorting with sort (e.g. "-points") and pagination with page and per_page.
 func (cc *ChallengeController) GetAllChallenges(c *gin.Context) {
-	var challenges []models.Challenge
+	filter, err := parseChallengeFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid query",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	viewer := viewerOf(c)
+	progress, err := loadSolveProgress(database.DB, viewer)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch challenges",
+		})
+		return
+	}
+
+	// Match first, then drop what the viewer may not see so that totals and
+	// pages only ever count visible challenges
+	var candidates []models.Challenge
+	if err := database.DB.Select("challenges.id, challenges.title, challenges.locked_visibility").
+		Preload("Prerequisites").
+		Scopes(releasedChallenges, filter.scope(progress)).
+		Find(&candidates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch challenges",
+		})
+		return
+	}
+
+	ids := []uint{}
+	search := strings.ToLower(filter.Search)
+	for _, candidate := range applyPrerequisites(candidates, progress) {
+		// Locked challenges must not be found through their hidden description
+		if candidate.Locked && !strings.Contains(strings.ToLower(candidate.Title), search) {
+			continue
+		}
+		ids = append(ids, candidate.ID)
+	}
+	total := len(ids)
+	ids = filter.paginate(ids)
 
-	// Only show active challenges and hide the flag
-	if err := database.DB.Select("id, title, description, category, points, hint, is_active, file_url, created_at").
-		Where("is_active = ?", true).
+	// Only show released challenges and hide the flag
+	var challenges []models.Challenge
+	if err := database.DB.Select(publicChallengeColumns).
+		Preload("Hints", orderHints).
+		Preload("Files", orderFiles).
+		Preload("Prerequisites").
+		Preload("Tags").
+		Where("id IN ?", ids).
+		Scopes(releasedChallenges).
+		Order(filter.Order).
 		Find(&challenges).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to fetch challenges",
@@ -26,9 +99,21 @@ func (cc *ChallengeController) GetAllChallenges(c *gin.Context) {
 		return
 	}
 
+	// Lock challenges the viewer has not unlocked yet
+	challenges = applyPrerequisites(challenges, progress)
+	for i := range challenges {
+		challenges[i].Solved = progress.solved[challenges[i].ID]
+	}
+
+	renderChallengeTemplates(viewer, challenges)
+	signChallengeFiles(viewer, challenges)
+
 	c.JSON(http.StatusOK, gin.H{
 		"challenges":       challenges,
-		"total_challenges": len(challenges),
+		"total_challenges": total,
+		"page":             filter.Page,
+		"per_page":         filter.PerPage,
+		"total_pages":      filter.totalPages(total),
 	})
 }
 
@@ -44,8 +129,13 @@ func (cc *ChallengeController) GetChallengeByID(c *gin.Context) {
 	}
 
 	var challenge models.Challenge
-	if err := database.DB.Select("id, title, description, category, points, hint, is_active, file_url, created_at").
-		Where("id = ? AND is_active = ?", challengeID, true).
+	if err := database.DB.Select(publicChallengeColumns).
+		Preload("Hints", orderHints).
+		Preload("Files", orderFiles).
+		Preload("Prerequisites").
+		Preload("Tags").
+		Where("id = ?", challengeID).
+		Scopes(releasedChallenges).
 		First(&challenge).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": "Challenge not found",
@@ -53,11 +143,118 @@ func (cc *ChallengeController) GetChallengeByID(c *gin.Context) {
 		return
 	}
 
+	viewer := viewerOf(c)
+	progress, err := loadSolveProgress(database.DB, viewer)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch challenge",
+		})
+		return
+	}
+
+	// Hidden locked challenges are indistinguishable from missing ones
+	challenges := applyPrerequisites([]models.Challenge{challenge}, progress)
+	if len(challenges) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Challenge not found",
+		})
+		return
+	}
+	challenges[0].Solved = progress.solved[challenge.ID]
+	renderChallengeTemplates(viewer, challenges)
+	signChallengeFiles(viewer, challenges)
+
 	c.JSON(http.StatusOK, gin.H{
-		"challenge": challenge,
+		"challenge": challenges[0],
 	})
 }
 
+// GetChallengeGraph handles GET /challenges/graph
+func (cc *ChallengeController) GetChallengeGraph(c *gin.Context) {
+	var challenges []models.Challenge
+	if err := database.DB.Select("id, title, category, points, locked_visibility").
+		Preload("Prerequisites").
+		Scopes(releasedChallenges).
+		Order("id ASC").
+		Find(&challenges).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch challenge graph",
+		})
+		return
+	}
+
+	progress, err := loadSolveProgress(database.DB, viewerOf(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch challenge graph",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, challengeGraph(applyPrerequisites(challenges, progress), progress))
+}
+
+// DownloadFile handles GET /files/:id
+func (cc *ChallengeController) DownloadFile(c *gin.Context) {
+	fileID, errFile := strconv.ParseUint(c.Param("id"), 10, 64)
+	userID, errUser := strconv.ParseUint(c.Query("user"), 10, 64)
+	expires, errExpires := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if errors.Join(errFile, errUser, errExpires) != nil ||
+		!utils.VerifyFileSignature(uint(fileID), uint(userID), expires, c.Query("signature"), time.Now()) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Invalid or expired download link",
+		})
+		return
+	}
+
+	var file models.ChallengeFile
+	if err := database.DB.First(&file, fileID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "File not found",
+		})
+		return
+	}
+
+	// The link only works while the challenge is visible to the user it was issued to
+	var challenge models.Challenge
+	if err := database.DB.Select("id").
+		Where("id = ?", file.ChallengeID).
+		Scopes(releasedChallenges).
+		First(&challenge).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "File not found",
+		})
+		return
+	}
+
+	var user *models.User
+	if userID != 0 {
+		var found models.User
+		if err := database.DB.First(&found, userID).Error; err != nil {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Invalid or expired download link",
+			})
+			return
+		}
+		user = &found
+	}
+	locked, err := challengeLocked(database.DB, user, challenge.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to download file",
+		})
+		return
+	}
+	if locked {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Challenge is locked; complete its prerequisites first",
+		})
+		return
+	}
+
+	serveChallengeFile(c, &file)
+}
+
 // SubmitFlag handles POST /challenges/:id/submit
 func (cc *ChallengeController) SubmitFlag(c *gin.Context) {
 	id := c.Param("id")
@@ -89,9 +286,21 @@ func (cc *ChallengeController) SubmitFlag(c *gin.Context) {
 		return
 	}
 
+	// Reject flags outside the configured format without counting an attempt
+	submittedFlag := utils.NormalizeFlag(req.Flag)
+	if !utils.MatchesFlagFormat(submittedFlag) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Invalid flag format",
+			"format": utils.GetFlagFormat(),
+		})
+		return
+	}
+
 	// Get challenge details
 	var challenge models.Challenge
-	if err := database.DB.Where("id = ? AND is_active = ?", challengeID, true).
+	if err := database.DB.Preload("Flags").
+		Where("id = ?", challengeID).
+		Scopes(releasedChallenges).
 		First(&challenge).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": "Challenge not found",
@@ -99,50 +308,140 @@ func (cc *ChallengeController) SubmitFlag(c *gin.Context) {
 		return
 	}
 
-	// Check if user already solved this challenge
-	var existingSubmission models.Submission
-	if err := database.DB.Where("user_id = ? AND challenge_id = ? AND is_correct = ?",
-		userID, challengeID, true).First(&existingSubmission).Error; err == nil {
+	teamMode := teamModeEnabled()
+
+	isCorrect := false
+
+	var owner string
+	var submission models.Submission
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the user (and team) row so concurrent submissions are serialized
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			return err
+		}
+
+		if teamMode {
+			if user.TeamID == nil {
+				return errNotInTeam
+			}
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.Team{}, *user.TeamID).Error; err != nil {
+				return err
+			}
+		}
+
+		// Check if user (or their team) already solved this challenge
+		solvedQuery := tx.Where("user_id = ? AND challenge_id = ? AND is_correct = ?",
+			user.ID, challenge.ID, true)
+		if teamMode {
+			solvedQuery = tx.Where("team_id = ? AND challenge_id = ? AND is_correct = ?",
+				*user.TeamID, challenge.ID, true)
+		}
+		var solved int64
+		if err := solvedQuery.Model(&models.Submission{}).Count(&solved).Error; err != nil {
+			return err
+		}
+		if solved > 0 {
+			return errAlreadySolved
+		}
+
+		locked, err := challengeLocked(tx, &user, challenge.ID)
+		if err != nil {
+			return err
+		}
+		if locked {
+			return errChallengeLocked
+		}
+
+		// Check if flag is correct against any accepted flag
+		owner = flagOwnerOf(&user)
+		isCorrect = matchesAnyFlag(challenge.Flags, submittedFlag, owner)
+
+		// Create submission record; correct flags are not kept so solves do not
+		// leak answers. The unique solve index is keyed by the owner the solve
+		// scores for, so a player who moved teams can still solve for the new team.
+		storedFlag, solvedBy := submittedFlag, ""
+		if isCorrect {
+			storedFlag, solvedBy = models.RedactedFlag, owner
+		}
+		submission = models.Submission{
+			UserID:      user.ID,
+			ChallengeID: challenge.ID,
+			TeamID:      user.TeamID,
+			SolvedBy:    solvedBy,
+			Flag:        storedFlag,
+			IsCorrect:   isCorrect,
+			IPAddress:   c.ClientIP(),
+			SubmittedAt: time.Now(),
+		}
+		if err := tx.Create(&submission).Error; err != nil {
+			// The unique solve index rejects a correct submission that lost a race
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return errAlreadySolved
+			}
+			return err
+		}
+		if !isCorrect {
+			return nil
+		}
+
+		// Dynamic challenges lose value for every solver as solves accumulate
+		if challenge.IsDynamic() {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&challenge, challenge.ID).Error; err != nil {
+				return err
+			}
+			if err := recalculateChallengeValue(tx, &challenge); err != nil {
+				return err
+			}
+		}
+
+		if err := syncUserScores(tx, user.ID); err != nil {
+			return err
+		}
+		if user.TeamID != nil {
+			return syncTeamScores(tx, *user.TeamID)
+		}
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, errNotInTeam):
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Join a team before submitting flags",
+		})
+		return
+	case errors.Is(err, errAlreadySolved):
 		c.JSON(http.StatusConflict, gin.H{
 			"error": "Challenge already solved",
 		})
 		return
-	}
-
-	// Check if flag is correct
-	isCorrect := req.Flag == challenge.Flag
-
-	// Create submission record
-	submission := models.Submission{
-		UserID:      userID.(uint),
-		ChallengeID: uint(challengeID),
-		Flag:        req.Flag,
-		IsCorrect:   isCorrect,
-		IPAddress:   c.ClientIP(),
-		SubmittedAt: time.Now(),
-	}
-
-	if err := database.DB.Create(&submission).Error; err != nil {
+	case errors.Is(err, errChallengeLocked):
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Challenge is locked; complete its prerequisites first",
+		})
+		return
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		})
+		return
+	case err != nil:
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to record submission",
 		})
 		return
 	}
 
-	// If correct, update user score
-	if isCorrect {
-		if err := database.DB.Model(&models.User{}).
-			Where("id = ?", userID).
-			Update("score", database.DB.Raw("score + ?", challenge.Points)).Error; err != nil {
-			// Log error but don't fail the request
-			c.JSON(http.StatusOK, gin.H{
-				"correct": true,
-				"message": "Correct flag! Points awarded.",
-				"points":  challenge.Points,
-			})
-			return
+	// A dynamic flag derived for someone else means the flag was shared. This
+	// is checked after the user and team rows are released since it scans
+	// every possible owner.
+	if !isCorrect {
+		if err := recordCheatIncident(database.DB, &challenge, &submission, owner); err != nil {
+			log.Printf("Failed to check submission %d for flag sharing: %v", submission.ID, err)
 		}
+	}
 
+	if isCorrect {
 		c.JSON(http.StatusOK, gin.H{
 			"correct": true,
 			"message": "Correct flag! Points awarded.",
@@ -155,3 +454,415 @@ func (cc *ChallengeController) SubmitFlag(c *gin.Context) {
 		})
 	}
 }
+
+// challengeTemplateData is exposed to the description and file URL templates
+// of challenges with a dynamic flag, e.g. {{.Flag}} in a per-user file link
+type challengeTemplateData struct {
+	Flag   string
+	Owner  string
+	UserID uint
+	TeamID uint
+}
+
+// renderChallengeTemplates renders the description and file URL of challenges
+// with a dynamic flag for the viewing user; anonymous viewers (nil) get empty values
+func renderChallengeTemplates(user *models.User, challenges []models.Challenge) {
+	if len(challenges) == 0 {
+		return
+	}
+
+	ids := make([]uint, len(challenges))
+	for i, challenge := range challenges {
+		ids[i] = challenge.ID
+	}
+
+	var dynamicFlags []models.ChallengeFlag
+	if err := database.DB.Where("challenge_id IN ? AND type = ?", ids, models.FlagDynamic).
+		Order("id ASC").
+		Find(&dynamicFlags).Error; err != nil || len(dynamicFlags) == 0 {
+		return
+	}
+
+	flagsByChallenge := make(map[uint]*models.ChallengeFlag, len(dynamicFlags))
+	for i := range dynamicFlags {
+		if _, exists := flagsByChallenge[dynamicFlags[i].ChallengeID]; !exists {
+			flagsByChallenge[dynamicFlags[i].ChallengeID] = &dynamicFlags[i]
+		}
+	}
+
+	for i := range challenges {
+		flag, ok := flagsByChallenge[challenges[i].ID]
+		if !ok {
+			continue
+		}
+
+		data := challengeTemplateData{}
+		if user != nil {
+			secret, err := flag.Plaintext()
+			if err != nil {
+				continue
+			}
+			data.Owner = flagOwnerOf(user)
+			data.Flag = utils.DeriveFlag(secret, flag.ChallengeID, data.Owner)
+			data.UserID = user.ID
+			if user.TeamID != nil {
+				data.TeamID = *user.TeamID
+			}
+		}
+
+		challenges[i].Description = renderTemplate(challenges[i].Description, data)
+		challenges[i].FileURL = renderTemplate(challenges[i].FileURL, data)
+	}
+}
+
+// renderTemplate executes a text template, returning the input unchanged on error
+func renderTemplate(text string, data challengeTemplateData) string {
+	if !strings.Contains(text, "{{") {
+		return text
+	}
+
+	tmpl, err := template.New("challenge").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return text
+	}
+
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return text
+	}
+	return rendered.String()
+}
+
+// flagOwnerOf returns the owner dynamic flags are derived for: the user's
+// team in team mode, otherwise the user
+func flagOwnerOf(user *models.User) string {
+	if teamModeEnabled() {
+		return models.FlagOwner(user.ID, user.TeamID)
+	}
+	return models.FlagOwner(user.ID, nil)
+}
+
+// matchesAnyFlag reports whether the submission is accepted by any of the flags
+func matchesAnyFlag(flags []models.ChallengeFlag, submitted, owner string) bool {
+	for i := range flags {
+		if flags[i].Matches(submitted, owner) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordCheatIncident checks whether an incorrect submission is a dynamic flag
+// derived for a different user or team and records an incident if so
+func recordCheatIncident(tx *gorm.DB, challenge *models.Challenge, submission *models.Submission, owner string) error {
+	// Most wrong guesses cannot be a derived flag at all
+	if !utils.IsDerivedFlagShape(submission.Flag) {
+		return nil
+	}
+
+	// Decrypt each dynamic secret once rather than per candidate owner
+	var secrets []string
+	for _, flag := range challenge.Flags {
+		if !flag.IsDynamic() {
+			continue
+		}
+		secret, err := flag.Plaintext()
+		if err != nil {
+			return err
+		}
+		secrets = append(secrets, secret)
+	}
+	if len(secrets) == 0 {
+		return nil
+	}
+
+	// Candidate owners are every team in team mode, otherwise every user
+	var owners []string
+	if teamModeEnabled() {
+		var teamIDs []uint
+		if err := tx.Model(&models.Team{}).Pluck("id", &teamIDs).Error; err != nil {
+			return err
+		}
+		for i := range teamIDs {
+			owners = append(owners, models.FlagOwner(0, &teamIDs[i]))
+		}
+	} else {
+		var userIDs []uint
+		if err := tx.Model(&models.User{}).Pluck("id", &userIDs).Error; err != nil {
+			return err
+		}
+		for _, userID := range userIDs {
+			owners = append(owners, models.FlagOwner(userID, nil))
+		}
+	}
+
+	for _, candidate := range owners {
+		if candidate == owner {
+			continue
+		}
+		for _, secret := range secrets {
+			expected := utils.DeriveFlag(secret, challenge.ID, candidate)
+			if subtle.ConstantTimeCompare([]byte(expected), []byte(submission.Flag)) != 1 {
+				continue
+			}
+
+			incident := models.CheatIncident{
+				ChallengeID: challenge.ID,
+				UserID:      submission.UserID,
+				TeamID:      submission.TeamID,
+				FlagOwner:   candidate,
+				Flag:        submission.Flag,
+				IPAddress:   submission.IPAddress,
+			}
+			return tx.Create(&incident).Error
+		}
+	}
+	return nil
+}
+
+// unlockedHintIDs returns the hints the user (or their team in team mode) has unlocked
+func unlockedHintIDs(db *gorm.DB, user *models.User, challengeID uint) (map[uint]bool, error) {
+	query := db.Model(&models.HintUnlock{}).
+		Joins("JOIN hints ON hints.id = hint_unlocks.hint_id").
+		Where("hints.challenge_id = ?", challengeID)
+	if teamModeEnabled() && user.TeamID != nil {
+		query = query.Where("hint_unlocks.team_id = ?", *user.TeamID)
+	} else {
+		query = query.Where("hint_unlocks.user_id = ?", user.ID)
+	}
+
+	var hintIDs []uint
+	if err := query.Pluck("hint_unlocks.hint_id", &hintIDs).Error; err != nil {
+		return nil, err
+	}
+
+	unlocked := make(map[uint]bool, len(hintIDs))
+	for _, hintID := range hintIDs {
+		unlocked[hintID] = true
+	}
+	return unlocked, nil
+}
+
+// hintResponse builds the hint payload, revealing content only once unlocked
+func hintResponse(hint *models.Hint, unlocked bool) gin.H {
+	// Free hints do not need to be purchased
+	unlocked = unlocked || hint.Cost == 0
+
+	response := gin.H{
+		"id":       hint.ID,
+		"cost":     hint.Cost,
+		"position": hint.Position,
+		"unlocked": unlocked,
+	}
+	if unlocked {
+		response["content"] = hint.Content
+	}
+	return response
+}
+
+// GetChallengeHints handles GET /challenges/:id/hints
+func (cc *ChallengeController) GetChallengeHints(c *gin.Context) {
+	id := c.Param("id")
+	challengeID, err := strconv.Atoi(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid challenge ID",
+		})
+		return
+	}
+
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	var challenge models.Challenge
+	if err := database.DB.Preload("Hints", orderHints).
+		Where("id = ?", challengeID).
+		Scopes(releasedChallenges).
+		First(&challenge).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Challenge not found",
+		})
+		return
+	}
+
+	locked, err := challengeLocked(database.DB, &user, challenge.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch hints",
+		})
+		return
+	}
+	if locked {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Challenge is locked; complete its prerequisites first",
+		})
+		return
+	}
+
+	unlocked, err := unlockedHintIDs(database.DB, &user, challenge.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch hints",
+		})
+		return
+	}
+
+	hints := make([]gin.H, len(challenge.Hints))
+	for i := range challenge.Hints {
+		hints[i] = hintResponse(&challenge.Hints[i], unlocked[challenge.Hints[i].ID])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"hints": hints,
+	})
+}
+
+// UnlockHint handles POST /challenges/:id/hints/:hint_id/unlock
+func (cc *ChallengeController) UnlockHint(c *gin.Context) {
+	challengeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid challenge ID",
+		})
+		return
+	}
+
+	hintID, err := strconv.Atoi(c.Param("hint_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid hint ID",
+		})
+		return
+	}
+
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	var hint models.Hint
+	if err := database.DB.Joins("JOIN challenges ON challenges.id = hints.challenge_id AND challenges.deleted_at IS NULL").
+		Where("hints.id = ? AND hints.challenge_id = ?", hintID, challengeID).
+		Scopes(releasedChallenges).
+		First(&hint).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Hint not found",
+		})
+		return
+	}
+
+	teamMode := teamModeEnabled()
+	alreadyUnlocked := false
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the user (and team) row so the score check and purchase are atomic
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			return err
+		}
+
+		balance := user.Score
+		unlockQuery := tx.Model(&models.HintUnlock{}).Where("hint_id = ? AND user_id = ?", hint.ID, user.ID)
+		if teamMode {
+			if user.TeamID == nil {
+				return errNotInTeam
+			}
+			var team models.Team
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&team, *user.TeamID).Error; err != nil {
+				return err
+			}
+			balance = team.Score
+			unlockQuery = tx.Model(&models.HintUnlock{}).Where("hint_id = ? AND team_id = ?", hint.ID, team.ID)
+		}
+
+		locked, err := challengeLocked(tx, &user, hint.ChallengeID)
+		if err != nil {
+			return err
+		}
+		if locked {
+			return errChallengeLocked
+		}
+
+		var existing int64
+		if err := unlockQuery.Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 || hint.Cost == 0 {
+			alreadyUnlocked = true
+			return nil
+		}
+
+		if balance < hint.Cost {
+			return errInsufficientPoints
+		}
+
+		unlock := models.HintUnlock{
+			HintID: hint.ID,
+			UserID: user.ID,
+			TeamID: user.TeamID,
+			Cost:   hint.Cost,
+		}
+		if err := tx.Create(&unlock).Error; err != nil {
+			return err
+		}
+
+		// The cost is deducted through the ledger
+		if err := syncUserScores(tx, user.ID); err != nil {
+			return err
+		}
+		if user.TeamID != nil {
+			return syncTeamScores(tx, *user.TeamID)
+		}
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, errNotInTeam):
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Join a team before unlocking hints",
+		})
+		return
+	case errors.Is(err, errChallengeLocked):
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Challenge is locked; complete its prerequisites first",
+		})
+		return
+	case errors.Is(err, errInsufficientPoints):
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Not enough points to unlock this hint",
+			"cost":  hint.Cost,
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to unlock hint",
+		})
+		return
+	}
+
+	message := "Hint unlocked successfully"
+	if alreadyUnlocked {
+		message = "Hint already unlocked"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"hint":    hintResponse(&hint, true),
+	})
+}
@@ -0,0 +1,265 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thelostleo/CTF-backend/database"
+	"github.com/thelostleo/CTF-backend/models"
+	"github.com/thelostleo/CTF-backend/utils"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupTestDB points database.DB at a fresh schema in the PostgreSQL database
+// named by TEST_DATABASE_URL and drops the schema when the test ends. Tests
+// that need a database are skipped when the variable is not set.
+func setupTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	random, err := utils.GenerateRandomToken(6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := "test_" + random
+	config := &gorm.Config{Logger: logger.Default.LogMode(logger.Silent), TranslateError: true}
+
+	admin, err := gorm.Open(postgres.Open(dsn), config)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+
+	db, err := gorm.Open(postgres.Open(withSearchPath(dsn, schema)), config)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := models.MigrateAll(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if sqlDB, err := admin.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// withSearchPath adds a search_path to a key/value or URL connection string
+func withSearchPath(dsn, schema string) string {
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		return dsn + " search_path=" + schema
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&search_path=" + schema
+	}
+	return dsn + "?search_path=" + schema
+}
+
+// createTestUser inserts a player, optionally in a team
+func createTestUser(t *testing.T, db *gorm.DB, name string, teamID *uint) *models.User {
+	t.Helper()
+	user := &models.User{Username: name, Email: name + "@example.com", Password: "unused", TeamID: teamID}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+// createTestChallenge inserts an active static challenge accepting the flag
+func createTestChallenge(t *testing.T, db *gorm.DB, points int, flag string) *models.Challenge {
+	t.Helper()
+	challenge := &models.Challenge{
+		Title:    "Race",
+		Category: "misc",
+		Points:   points,
+		IsActive: true,
+		Flags:    []models.ChallengeFlag{{Content: flag, Type: models.FlagStatic}},
+	}
+	if err := db.Create(challenge).Error; err != nil {
+		t.Fatalf("create challenge: %v", err)
+	}
+	return challenge
+}
+
+// submitRouter serves SubmitFlag for the user ID in the X-Test-User header,
+// standing in for the auth middleware
+func submitRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	controller := &ChallengeController{}
+	router.POST("/challenges/:id/submit", func(c *gin.Context) {
+		var userID uint
+		fmt.Sscan(c.GetHeader("X-Test-User"), &userID)
+		c.Set("userID", userID)
+	}, controller.SubmitFlag)
+	return router
+}
+
+// submitConcurrently sends one submission per user in the list at the same
+// time and returns the status codes
+func submitConcurrently(t *testing.T, router *gin.Engine, challengeID uint, flag string, users []uint) []int {
+	t.Helper()
+	body, _ := json.Marshal(gin.H{"flag": flag})
+	codes := make([]int, len(users))
+
+	var ready, done sync.WaitGroup
+	start := make(chan struct{})
+	for i, userID := range users {
+		ready.Add(1)
+		done.Add(1)
+		go func(i int, userID uint) {
+			defer done.Done()
+			request := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/challenges/%d/submit", challengeID), bytes.NewReader(body))
+			request.Header.Set("Content-Type", "application/json")
+			request.Header.Set("X-Test-User", fmt.Sprint(userID))
+			recorder := httptest.NewRecorder()
+			ready.Done()
+			<-start
+			router.ServeHTTP(recorder, request)
+			codes[i] = recorder.Code
+		}(i, userID)
+	}
+	ready.Wait()
+	close(start)
+	done.Wait()
+	return codes
+}
+
+// countCodes tallies status codes
+func countCodes(codes []int) map[int]int {
+	counts := make(map[int]int)
+	for _, code := range codes {
+		counts[code]++
+	}
+	return counts
+}
+
+func TestSubmitFlagConcurrentUserMode(t *testing.T) {
+	db := setupTestDB(t)
+	t.Setenv("TEAM_MODE", "false")
+	t.Setenv("FLAG_FORMAT", "")
+
+	user := createTestUser(t, db, "racer", nil)
+	challenge := createTestChallenge(t, db, 100, "flag{race}")
+
+	const parallel = 20
+	users := make([]uint, parallel)
+	for i := range users {
+		users[i] = user.ID
+	}
+	codes := countCodes(submitConcurrently(t, submitRouter(), challenge.ID, "flag{race}", users))
+
+	if codes[http.StatusOK] != 1 || codes[http.StatusConflict] != parallel-1 {
+		t.Fatalf("want 1 accepted and %d conflicts, got %v", parallel-1, codes)
+	}
+
+	var solves int64
+	db.Model(&models.Submission{}).Where("challenge_id = ? AND is_correct = ?", challenge.ID, true).Count(&solves)
+	if solves != 1 {
+		t.Fatalf("want 1 correct submission, got %d", solves)
+	}
+
+	var reloaded models.User
+	db.First(&reloaded, user.ID)
+	if reloaded.Score != 100 {
+		t.Fatalf("want score 100, got %d", reloaded.Score)
+	}
+}
+
+func TestSubmitFlagConcurrentTeamMode(t *testing.T) {
+	db := setupTestDB(t)
+	t.Setenv("TEAM_MODE", "true")
+	t.Setenv("FLAG_FORMAT", "")
+
+	captain := createTestUser(t, db, "captain", nil)
+	team := &models.Team{Name: "racers", InviteCode: "invite", CaptainID: captain.ID}
+	if err := db.Create(team).Error; err != nil {
+		t.Fatalf("create team: %v", err)
+	}
+	db.Model(captain).Update("team_id", team.ID)
+	member := createTestUser(t, db, "member", &team.ID)
+	challenge := createTestChallenge(t, db, 100, "flag{team}")
+
+	// Both members submit at once; the team row lock and the unique solve
+	// index, keyed by team in team mode, keep the second member from scoring
+	const parallel = 20
+	users := make([]uint, parallel)
+	for i := range users {
+		users[i] = captain.ID
+		if i%2 == 1 {
+			users[i] = member.ID
+		}
+	}
+	codes := countCodes(submitConcurrently(t, submitRouter(), challenge.ID, "flag{team}", users))
+
+	if codes[http.StatusOK] != 1 || codes[http.StatusConflict] != parallel-1 {
+		t.Fatalf("want 1 accepted and %d conflicts, got %v", parallel-1, codes)
+	}
+
+	var solves int64
+	db.Model(&models.Submission{}).Where("team_id = ? AND challenge_id = ? AND is_correct = ?", team.ID, challenge.ID, true).Count(&solves)
+	if solves != 1 {
+		t.Fatalf("want 1 correct team submission, got %d", solves)
+	}
+
+	var reloaded models.Team
+	db.First(&reloaded, team.ID)
+	if reloaded.Score != 100 {
+		t.Fatalf("want team score 100, got %d", reloaded.Score)
+	}
+
+	var memberScores int64
+	db.Model(&models.User{}).Where("team_id = ?", team.ID).Select("COALESCE(SUM(score), 0)").Scan(&memberScores)
+	if memberScores != 100 {
+		t.Fatalf("want member scores to add up to 100, got %d", memberScores)
+	}
+
+	// A member who moves to another team can solve the challenge again for
+	// the new team, without the solve counting twice towards their own score
+	other := &models.Team{Name: "movers", InviteCode: "invite-2", CaptainID: member.ID}
+	if err := db.Create(other).Error; err != nil {
+		t.Fatalf("create team: %v", err)
+	}
+	db.Model(member).Update("team_id", other.ID)
+
+	router := submitRouter()
+	for i, want := range []int{http.StatusOK, http.StatusConflict} {
+		if code := submitConcurrently(t, router, challenge.ID, "flag{team}", []uint{member.ID})[0]; code != want {
+			t.Fatalf("submission %d after moving teams: want %d, got %d", i+1, want, code)
+		}
+	}
+
+	db.First(&reloaded, other.ID)
+	if reloaded.Score != 100 {
+		t.Fatalf("want new team score 100, got %d", reloaded.Score)
+	}
+	var mover models.User
+	db.First(&mover, member.ID)
+	if mover.Score != 100 {
+		t.Fatalf("want the member's score to count the challenge once, got %d", mover.Score)
+	}
+}
@@ -0,0 +1,290 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thelostleo/CTF-backend/database"
+	"github.com/thelostleo/CTF-backend/models"
+	"github.com/thelostleo/CTF-backend/utils"
+	"gorm.io/gorm"
+)
+
+// fileDownloadPath is where signed challenge file downloads are served
+const fileDownloadPath = "/api/v1/files/"
+
+// unsafeFileNameChars are replaced in file names used inside storage keys
+var unsafeFileNameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// orderFiles preloads files in upload order
+func orderFiles(db *gorm.DB) *gorm.DB {
+	return db.Order("id ASC")
+}
+
+// maxUploadSize returns the largest accepted upload in bytes (MAX_UPLOAD_SIZE_MB, default 100)
+func maxUploadSize() int64 {
+	return int64(utils.GetEnvAsInt("MAX_UPLOAD_SIZE_MB", 100)) << 20
+}
+
+// fileStorageKey returns a fresh storage key for a challenge file; the random
+// part keeps keys unguessable and lets files share a name
+func fileStorageKey(challengeID uint, name string) (string, error) {
+	random, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	safeName := strings.Trim(unsafeFileNameChars.ReplaceAllString(path.Base(name), "_"), "._")
+	if safeName == "" {
+		safeName = "file"
+	}
+	return fmt.Sprintf("challenges/%d/%s/%s", challengeID, random, safeName), nil
+}
+
+// signChallengeFiles sets a signed, time-limited download URL on every file
+// of the challenges for the viewing user (nil for anonymous viewers)
+func signChallengeFiles(user *models.User, challenges []models.Challenge) {
+	var userID uint
+	if user != nil {
+		userID = user.ID
+	}
+	expires := time.Now().Add(utils.GetFileURLTTL())
+
+	for i := range challenges {
+		for j := range challenges[i].Files {
+			file := &challenges[i].Files[j]
+			query, err := utils.SignFileURL(file.ID, userID, expires)
+			if err != nil {
+				log.Printf("Failed to sign download URL for file %d: %v", file.ID, err)
+				continue
+			}
+			file.DownloadURL = fmt.Sprintf("%s%d?%s", fileDownloadPath, file.ID, query)
+		}
+	}
+}
+
+// serveChallengeFile streams a stored file as an attachment
+func serveChallengeFile(c *gin.Context, file *models.ChallengeFile) {
+	content, err := utils.GetStorage().Open(file.StorageKey)
+	if err != nil {
+		log.Printf("Failed to open file %d: %v", file.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to download file",
+		})
+		return
+	}
+	defer content.Close()
+
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.DataFromReader(http.StatusOK, file.Size, contentType, content, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType("attachment", map[string]string{"filename": file.Name}),
+		"X-Content-Type-Options": "nosniff",
+		"ETag":                   `"` + file.SHA256 + `"`,
+	})
+}
+
+// storeChallengeFile uploads a multipart file to storage, computing its checksum on the way
+func storeChallengeFile(storage utils.Storage, challengeID uint, header *multipart.FileHeader) (*models.ChallengeFile, error) {
+	content, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	key, err := fileStorageKey(challengeID, header.Filename)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := header.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(header.Filename))
+	}
+
+	hash := sha256.New()
+	if err := storage.Put(key, io.TeeReader(content, hash), header.Size, contentType); err != nil {
+		return nil, err
+	}
+
+	return &models.ChallengeFile{
+		ChallengeID: challengeID,
+		Name:        path.Base(header.Filename),
+		StorageKey:  key,
+		Size:        header.Size,
+		ContentType: contentType,
+		SHA256:      hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// findChallengeFileParam loads the file referenced by :file_id if it belongs to
+// the challenge in :id, writing an error response otherwise
+func findChallengeFileParam(c *gin.Context) (*models.ChallengeFile, bool) {
+	challengeID, errChallenge := strconv.Atoi(c.Param("id"))
+	fileID, errFile := strconv.Atoi(c.Param("file_id"))
+	if errChallenge != nil || errFile != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid challenge or file ID",
+		})
+		return nil, false
+	}
+
+	if !authorizeChallenge(c, uint(challengeID)) {
+		return nil, false
+	}
+
+	var file models.ChallengeFile
+	if err := database.DB.Where("id = ? AND challenge_id = ?", fileID, challengeID).First(&file).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "File not found",
+		})
+		return nil, false
+	}
+	return &file, true
+}
+
+// GetChallengeFiles handles GET /admin/challenges/:id/files
+func (ac *AdminController) GetChallengeFiles(c *gin.Context) {
+	challengeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid challenge ID",
+		})
+		return
+	}
+
+	if !authorizeChallenge(c, uint(challengeID)) {
+		return
+	}
+
+	var files []models.ChallengeFile
+	if err := orderFiles(database.DB).Where("challenge_id = ?", challengeID).Find(&files).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch files",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"files": files,
+	})
+}
+
+// UploadChallengeFiles handles POST /admin/challenges/:id/files
+func (ac *AdminController) UploadChallengeFiles(c *gin.Context) {
+	challengeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid challenge ID",
+		})
+		return
+	}
+
+	if !authorizeChallenge(c, uint(challengeID)) {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadSize())
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid upload; send multipart/form-data with one or more \"file\" fields",
+			"details": err.Error(),
+		})
+		return
+	}
+	headers := form.File["file"]
+	if len(headers) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "At least one file is required",
+		})
+		return
+	}
+
+	storage := utils.GetStorage()
+	uploaderID := c.GetUint("userID")
+	files := make([]models.ChallengeFile, 0, len(headers))
+
+	// Stored files are removed again if any part of the upload fails
+	cleanup := func() {
+		for _, file := range files {
+			if err := storage.Delete(file.StorageKey); err != nil {
+				log.Printf("Failed to remove stored file %s: %v", file.StorageKey, err)
+			}
+		}
+	}
+
+	for _, header := range headers {
+		file, err := storeChallengeFile(storage, uint(challengeID), header)
+		if err != nil {
+			log.Printf("Failed to store file %q for challenge %d: %v", header.Filename, challengeID, err)
+			cleanup()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to store file",
+			})
+			return
+		}
+		file.UploadedBy = &uploaderID
+		files = append(files, *file)
+	}
+
+	if err := database.DB.Create(&files).Error; err != nil {
+		cleanup()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to save files",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Files uploaded successfully",
+		"files":   files,
+	})
+}
+
+// DownloadChallengeFile handles GET /admin/challenges/:id/files/:file_id
+func (ac *AdminController) DownloadChallengeFile(c *gin.Context) {
+	file, ok := findChallengeFileParam(c)
+	if !ok {
+		return
+	}
+
+	serveChallengeFile(c, file)
+}
+
+// DeleteChallengeFile handles DELETE /admin/challenges/:id/files/:file_id
+func (ac *AdminController) DeleteChallengeFile(c *gin.Context) {
+	file, ok := findChallengeFileParam(c)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Delete(file).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to delete file",
+		})
+		return
+	}
+
+	// A leftover object is harmless once its row is gone, so only log failures
+	if err := utils.GetStorage().Delete(file.StorageKey); err != nil {
+		log.Printf("Failed to remove stored file %s: %v", file.StorageKey, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "File deleted successfully",
+	})
+}
@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thelostleo/CTF-backend/models"
+	"gorm.io/gorm"
+)
+
+// maxChallengesPerPage caps per_page on the challenge list
+const maxChallengesPerPage = 100
+
+// challengeSorts maps the sort parameter of the challenge list to SQL
+var challengeSorts = map[string]string{
+	"points":     "challenges.points",
+	"title":      "challenges.title",
+	"category":   "challenges.category",
+	"created_at": "challenges.created_at",
+	"difficulty": difficultyRank(),
+	"solves":     "(SELECT COUNT(*) FROM submissions WHERE submissions.challenge_id = challenges.id AND submissions.is_correct = true)",
+}
+
+// difficultyRank orders difficulties from easy to insane, unrated last
+func difficultyRank() string {
+	var rank strings.Builder
+	rank.WriteString("CASE challenges.difficulty")
+	for i, difficulty := range models.Difficulties {
+		fmt.Fprintf(&rank, " WHEN '%s' THEN %d", difficulty, i)
+	}
+	fmt.Fprintf(&rank, " ELSE %d END", len(models.Difficulties))
+	return rank.String()
+}
+
+// challengeFilter is the query of GET /challenges. List parameters take
+// comma-separated values and match any of them.
+type challengeFilter struct {
+	Categories   []string
+	Tags         []string
+	Difficulties []string
+	Solved       *bool
+	MinPoints    *int
+	MaxPoints    *int
+	Search       string
+	Order        string
+	Page         int
+	PerPage      int // 0 returns every challenge on one page
+}
+
+// splitList splits a comma-separated query parameter, dropping empty values
+func splitList(value string) []string {
+	var values []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
+}
+
+// optionalInt parses an optional integer query parameter
+func optionalInt(c *gin.Context, name string) (*int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a number", name)
+	}
+	return &number, nil
+}
+
+// parseChallengeFilter reads the filters, sort order and page of the challenge list
+func parseChallengeFilter(c *gin.Context) (*challengeFilter, error) {
+	filter := &challengeFilter{
+		Categories:   splitList(c.Query("category")),
+		Difficulties: splitList(c.Query("difficulty")),
+		Search:       strings.TrimSpace(c.Query("search")),
+		Page:         1,
+	}
+	for _, tag := range splitList(c.Query("tag")) {
+		filter.Tags = append(filter.Tags, models.NormalizeTagName(tag))
+	}
+	for _, difficulty := range filter.Difficulties {
+		if !models.ValidDifficulty(difficulty) {
+			return nil, errors.New("difficulty must be easy, medium, hard or insane")
+		}
+	}
+
+	if solved := c.Query("solved"); solved != "" {
+		value, err := strconv.ParseBool(solved)
+		if err != nil {
+			return nil, errors.New("solved must be true or false")
+		}
+		filter.Solved = &value
+	}
+
+	var err error
+	if filter.MinPoints, err = optionalInt(c, "min_points"); err != nil {
+		return nil, err
+	}
+	if filter.MaxPoints, err = optionalInt(c, "max_points"); err != nil {
+		return nil, err
+	}
+
+	// Sort by a field, descending with a leading "-"; ties keep a stable order
+	filter.Order = "challenges.category ASC, challenges.points ASC"
+	if sort := c.Query("sort"); sort != "" {
+		direction := "ASC"
+		if strings.HasPrefix(sort, "-") {
+			direction = "DESC"
+			sort = sort[1:]
+		}
+		column, ok := challengeSorts[sort]
+		if !ok {
+			return nil, errors.New("sort must be one of points, title, category, difficulty, solves or created_at")
+		}
+		filter.Order = column + " " + direction
+	}
+	filter.Order += ", challenges.id ASC"
+
+	// Pagination is opt-in so clients listing every challenge keep working
+	if c.Query("page") != "" || c.Query("per_page") != "" {
+		filter.PerPage = 25
+		if page, err := optionalInt(c, "page"); err != nil || (page != nil && *page < 1) {
+			return nil, errors.New("page must be a positive number")
+		} else if page != nil {
+			filter.Page = *page
+		}
+		if perPage, err := optionalInt(c, "per_page"); err != nil || (perPage != nil && (*perPage < 1 || *perPage > maxChallengesPerPage)) {
+			return nil, fmt.Errorf("per_page must be between 1 and %d", maxChallengesPerPage)
+		} else if perPage != nil {
+			filter.PerPage = *perPage
+		}
+		// The offset of the page must fit in an int
+		if filter.Page > math.MaxInt/filter.PerPage {
+			return nil, errors.New("page is too large")
+		}
+	}
+	return filter, nil
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// scope limits a challenge query to the filter, using progress for the solved filter
+func (f *challengeFilter) scope(progress *solveProgress) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(f.Categories) > 0 {
+			db = db.Where("challenges.category IN ?", f.Categories)
+		}
+		if len(f.Difficulties) > 0 {
+			db = db.Where("challenges.difficulty IN ?", f.Difficulties)
+		}
+		if len(f.Tags) > 0 {
+			tagged := db.Session(&gorm.Session{NewDB: true}).
+				Table("challenge_tags").
+				Select("challenge_tags.challenge_id").
+				Joins("JOIN tags ON tags.id = challenge_tags.tag_id").
+				Where("tags.name IN ?", f.Tags)
+			db = db.Where("challenges.id IN (?)", tagged)
+		}
+		if f.MinPoints != nil {
+			db = db.Where("challenges.points >= ?", *f.MinPoints)
+		}
+		if f.MaxPoints != nil {
+			db = db.Where("challenges.points <= ?", *f.MaxPoints)
+		}
+		if f.Search != "" {
+			pattern := "%" + escapeLike(f.Search) + "%"
+			db = db.Where("challenges.title ILIKE ? OR challenges.description ILIKE ?", pattern, pattern)
+		}
+
+		if f.Solved != nil {
+			solved := make([]uint, 0, len(progress.solved))
+			for id := range progress.solved {
+				solved = append(solved, id)
+			}
+			switch {
+			case *f.Solved && len(solved) == 0:
+				db = db.Where("1 = 0")
+			case *f.Solved:
+				db = db.Where("challenges.id IN ?", solved)
+			case len(solved) > 0:
+				db = db.Where("challenges.id NOT IN ?", solved)
+			}
+		}
+		return db.Order(f.Order)
+	}
+}
+
+// paginate returns the IDs on the requested page
+func (f *challengeFilter) paginate(ids []uint) []uint {
+	if f.PerPage == 0 {
+		return ids
+	}
+	// Compare pages rather than offsets so a huge page cannot overflow
+	if len(ids) == 0 || f.Page < 1 || f.Page > f.totalPages(len(ids)) {
+		return []uint{}
+	}
+	start := (f.Page - 1) * f.PerPage
+	end := start + f.PerPage
+	if end > len(ids) {
+		end = len(ids)
+	}
+	return ids[start:end]
+}
+
+// totalPages returns the number of pages for the given number of challenges
+func (f *challengeFilter) totalPages(total int) int {
+	if f.PerPage == 0 || total == 0 {
+		return 1
+	}
+	return (total + f.PerPage - 1) / f.PerPage
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// filterFor parses the challenge list query string
+func filterFor(query string) (*challengeFilter, error) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/challenges?"+query, nil)
+	return parseChallengeFilter(c)
+}
+
+func TestParseChallengeFilter(t *testing.T) {
+	tests := []struct {
+		query   string
+		valid   bool
+		page    int
+		perPage int
+		order   string
+	}{
+		{query: "", valid: true, page: 1, perPage: 0, order: "challenges.category ASC, challenges.points ASC, challenges.id ASC"},
+		{query: "page=2", valid: true, page: 2, perPage: 25},
+		{query: "per_page=10", valid: true, page: 1, perPage: 10},
+		{query: "page=3&per_page=100", valid: true, page: 3, perPage: 100},
+		{query: "sort=-points", valid: true, page: 1, order: "challenges.points DESC, challenges.id ASC"},
+		{query: "difficulty=easy,hard", valid: true, page: 1},
+		{query: "solved=true&min_points=10&max_points=500", valid: true, page: 1},
+		{query: "page=0"},
+		{query: "page=-1"},
+		{query: "page=abc"},
+		{query: "per_page=0"},
+		{query: "per_page=101"},
+		{query: "page=4611686018427387904&per_page=4"},
+		{query: "page=" + strconv.Itoa(math.MaxInt)},
+		{query: "sort=password"},
+		{query: "difficulty=impossible"},
+		{query: "solved=maybe"},
+		{query: "min_points=ten"},
+	}
+	for _, tt := range tests {
+		filter, err := filterFor(tt.query)
+		if !tt.valid {
+			if err == nil {
+				t.Errorf("%q: want an error, got %+v", tt.query, filter)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tt.query, err)
+			continue
+		}
+		if filter.Page != tt.page || filter.PerPage != tt.perPage {
+			t.Errorf("%q: want page %d of %d, got page %d of %d", tt.query, tt.page, tt.perPage, filter.Page, filter.PerPage)
+		}
+		if tt.order != "" && filter.Order != tt.order {
+			t.Errorf("%q: want order %q, got %q", tt.query, tt.order, filter.Order)
+		}
+	}
+}
+
+func TestChallengeFilterPaginate(t *testing.T) {
+	ids := []uint{1, 2, 3, 4, 5, 6, 7}
+	tests := []struct {
+		page, perPage int
+		want          []uint
+		pages         int
+	}{
+		{page: 1, perPage: 0, want: ids, pages: 1},
+		{page: 1, perPage: 3, want: []uint{1, 2, 3}, pages: 3},
+		{page: 3, perPage: 3, want: []uint{7}, pages: 3},
+		{page: 4, perPage: 3, want: []uint{}, pages: 3},
+		{page: 1, perPage: 7, want: ids, pages: 1},
+		{page: 4611686018427387904, perPage: 4, want: []uint{}, pages: 2},
+		{page: math.MaxInt, perPage: 100, want: []uint{}, pages: 1},
+	}
+	for _, tt := range tests {
+		filter := &challengeFilter{Page: tt.page, PerPage: tt.perPage}
+		if got := filter.paginate(ids); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("page %d of %d: want %v, got %v", tt.page, tt.perPage, tt.want, got)
+		}
+		if got := filter.totalPages(len(ids)); got != tt.pages {
+			t.Errorf("page size %d: want %d pages, got %d", tt.perPage, tt.pages, got)
+		}
+	}
+
+	empty := &challengeFilter{Page: 1, PerPage: 25}
+	if got := empty.paginate(nil); len(got) != 0 {
+		t.Errorf("want an empty page, got %v", got)
+	}
+	if got := empty.totalPages(0); got != 1 {
+		t.Errorf("want 1 page for no challenges, got %d", got)
+	}
+}
@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thelostleo/CTF-backend/database"
+	"github.com/thelostleo/CTF-backend/models"
+)
+
+type EventController struct{}
+
+// eventResponse builds the public view of the event configuration
+func eventResponse(event *models.Event) gin.H {
+	now := time.Now()
+	return gin.H{
+		"name":        event.Name,
+		"start_time":  event.StartTime,
+		"end_time":    event.EndTime,
+		"freeze_time": event.FreezeTime,
+		"status":      event.Status(now),
+		"frozen":      event.IsFrozen(now),
+	}
+}
+
+// GetEvent handles GET /event
+func (ec *EventController) GetEvent(c *gin.Context) {
+	event, err := models.LoadEvent(database.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to load event configuration",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"event": eventResponse(event),
+	})
+}
+
+// UpdateEvent handles PUT /admin/event
+func (ec *EventController) UpdateEvent(c *gin.Context) {
+	var req struct {
+		Name       string     `json:"name"`
+		StartTime  *time.Time `json:"start_time"`
+		EndTime    *time.Time `json:"end_time"`
+		FreezeTime *time.Time `json:"freeze_time"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if req.StartTime != nil && req.EndTime != nil && !req.EndTime.After(*req.StartTime) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "end_time must be after start_time",
+		})
+		return
+	}
+
+	if req.FreezeTime != nil {
+		if (req.StartTime != nil && req.FreezeTime.Before(*req.StartTime)) ||
+			(req.EndTime != nil && req.FreezeTime.After(*req.EndTime)) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "freeze_time must be between start_time and end_time",
+			})
+			return
+		}
+	}
+
+	event, err := models.LoadEvent(database.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to load event configuration",
+		})
+		return
+	}
+
+	// The request replaces the whole window; omitted times are cleared
+	event.Name = req.Name
+	event.StartTime = req.StartTime
+	event.EndTime = req.EndTime
+	event.FreezeTime = req.FreezeTime
+
+	if err := database.DB.Save(event).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update event configuration",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Event updated successfully",
+		"event":   eventResponse(event),
+	})
+}
+
+// GetAnnouncements handles GET /announcements
+func (ec *EventController) GetAnnouncements(c *gin.Context) {
+	query := database.DB.Order("created_at DESC").Limit(100)
+
+	// Clients can poll for announcements newer than the last one they saw
+	if since := c.Query("since"); since != "" {
+		sinceTime, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "since must be an RFC 3339 timestamp",
+			})
+			return
+		}
+		query = query.Where("created_at > ?", sinceTime)
+	}
+
+	var announcements []models.Announcement
+	if err := query.Find(&announcements).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch announcements",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"announcements":       announcements,
+		"total_announcements": len(announcements),
+	})
+}
+
+// CreateAnnouncement handles POST /admin/announcements
+func (ec *EventController) CreateAnnouncement(c *gin.Context) {
+	var req struct {
+		Title   string `json:"title" binding:"required,max=200"`
+		Content string `json:"content"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	announcement := models.Announcement{
+		Title:   req.Title,
+		Content: req.Content,
+	}
+	if err := database.DB.Create(&announcement).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create announcement",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":      "Announcement created successfully",
+		"announcement": announcement,
+	})
+}
+
+// DeleteAnnouncement handles DELETE /admin/announcements/:id
+func (ec *EventController) DeleteAnnouncement(c *gin.Context) {
+	announcementID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid announcement ID",
+		})
+		return
+	}
+
+	result := database.DB.Delete(&models.Announcement{}, announcementID)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to delete announcement",
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Announcement not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Announcement deleted successfully",
+	})
+}
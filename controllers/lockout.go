@@ -0,0 +1,321 @@
+package controllers
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thelostleo/CTF-backend/database"
+	"github.com/thelostleo/CTF-backend/models"
+	"github.com/thelostleo/CTF-backend/utils"
+	"gorm.io/gorm"
+)
+
+// Reasons recorded for failed login attempts
+const (
+	loginFailUnknownUser   = "unknown_user"
+	loginFailBadPassword   = "bad_password"
+	loginFailBadSecondStep = "bad_2fa_code"
+	loginFailThrottled     = "throttled"
+	loginFailLocked        = "locked"
+	loginFailBlocked       = "banned_or_suspended"
+)
+
+// loginDelayAfter returns after how many consecutive failures logins are slowed down (LOGIN_DELAY_AFTER, default 3)
+func loginDelayAfter() int {
+	return utils.GetEnvAsInt("LOGIN_DELAY_AFTER", 3)
+}
+
+// loginLockoutThreshold returns after how many consecutive failures an account is locked (LOGIN_LOCKOUT_THRESHOLD, default 10)
+func loginLockoutThreshold() int {
+	return utils.GetEnvAsInt("LOGIN_LOCKOUT_THRESHOLD", 10)
+}
+
+// loginLockoutDuration returns how long an account stays locked (LOGIN_LOCKOUT_DURATION, default 15m)
+func loginLockoutDuration() time.Duration {
+	return utils.GetEnvAsDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute)
+}
+
+// loginDelay returns how long to wait after the last failure before another
+// attempt is accepted; it doubles with every failure, up to one minute
+func loginDelay(failures int) time.Duration {
+	excess := failures - loginDelayAfter()
+	if excess < 0 {
+		return 0
+	}
+	delay := time.Duration(math.Pow(2, float64(excess))) * time.Second
+	if delay > time.Minute || delay <= 0 {
+		delay = time.Minute
+	}
+	return delay
+}
+
+// loginRetryAfter returns how long the user must wait before attempting to
+// log in again and whether the account is locked
+func loginRetryAfter(user *models.User, now time.Time) (time.Duration, bool) {
+	if user.IsLocked(now) {
+		return user.LockedUntil.Sub(now), true
+	}
+	if user.LastFailedLoginAt != nil {
+		if wait := user.LastFailedLoginAt.Add(loginDelay(user.FailedLogins)).Sub(now); wait > 0 {
+			return wait, false
+		}
+	}
+	return 0, false
+}
+
+// loginThrottle describes an attempt refused because the account is locked
+// or must wait before the next attempt
+type loginThrottle struct {
+	wait   time.Duration
+	locked bool
+}
+
+// checkLoginThrottle returns the throttle for a user, or nil when an attempt is allowed
+func checkLoginThrottle(user *models.User, now time.Time) *loginThrottle {
+	wait, locked := loginRetryAfter(user, now)
+	if wait <= 0 {
+		return nil
+	}
+	return &loginThrottle{wait: wait, locked: locked}
+}
+
+// unknownUserWindow is how far back failed attempts for a username that does
+// not exist are replayed by unknownUserThrottle
+const unknownUserWindow = 24 * time.Hour
+
+// unknownUserThrottle returns the throttle an account would have after the
+// recent failed attempts recorded for a username that does not exist, so that
+// 429 responses do not reveal which usernames exist
+func unknownUserThrottle(username string, now time.Time) (*loginThrottle, error) {
+	var failures []time.Time
+	if err := database.DB.Model(&models.LoginAttempt{}).
+		Where("username = ? AND user_id IS NULL AND reason = ? AND created_at > ?",
+			username, loginFailUnknownUser, now.Add(-unknownUserWindow)).
+		Order("created_at ASC").
+		Pluck("created_at", &failures).Error; err != nil {
+		return nil, err
+	}
+
+	user := replayFailedLogins(failures)
+	return checkLoginThrottle(&user, now), nil
+}
+
+// replayFailedLogins returns the lockout state an account would have after
+// the failures, counted the way countFailedLogin counts them
+func replayFailedLogins(failures []time.Time) models.User {
+	var user models.User
+	for i := range failures {
+		user.FailedLogins++
+		user.LastFailedLoginAt = &failures[i]
+		if user.FailedLogins >= loginLockoutThreshold() {
+			lockedUntil := failures[i].Add(loginLockoutDuration())
+			user.LockedUntil = &lockedUntil
+			user.FailedLogins = 0
+		}
+	}
+	return user
+}
+
+// respondLoginThrottled records the refused attempt and answers with 429
+func respondLoginThrottled(c *gin.Context, user *models.User, throttle *loginThrottle) {
+	respondThrottled(c, user, user.Username, throttle)
+}
+
+// respondThrottled records a refused attempt for a user, nil when the
+// username is unknown, and answers with 429
+func respondThrottled(c *gin.Context, user *models.User, username string, throttle *loginThrottle) {
+	retryAfter := int(math.Ceil(throttle.wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	if throttle.locked {
+		recordLoginAttempt(c, user, username, false, loginFailLocked)
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Account temporarily locked due to too many failed login attempts",
+			"retry_after": retryAfter,
+		})
+		return
+	}
+
+	recordLoginAttempt(c, user, username, false, loginFailThrottled)
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Too many failed login attempts, please wait before trying again",
+		"retry_after": retryAfter,
+	})
+}
+
+// passwordAttempt is the outcome of checkPassword
+type passwordAttempt struct {
+	throttle    *loginThrottle // Set when the password was not checked
+	ok          bool
+	needsRehash bool
+}
+
+// checkPassword verifies a user's password under the login lockout. The
+// throttle check, the password check and counting a failure happen in one
+// transaction holding the user row lock, so concurrent guesses cannot get past
+// the limits. user is refreshed from the locked row.
+func checkPassword(user *models.User, password string) (*passwordAttempt, error) {
+	attempt := &passwordAttempt{}
+	err := withLockedUser(user.ID, func(tx *gorm.DB, locked *models.User) error {
+		*user = *locked
+		now := time.Now()
+		if attempt.throttle = checkLoginThrottle(locked, now); attempt.throttle != nil {
+			return nil
+		}
+
+		ok, needsRehash, err := utils.VerifyPassword(locked.Password, password)
+		if err != nil || !ok {
+			return countFailedLogin(tx, locked, now)
+		}
+		attempt.ok, attempt.needsRehash = true, needsRehash
+		return nil
+	})
+	return attempt, err
+}
+
+// dummyPasswordHash is checked for unknown usernames so that the response
+// time does not reveal which accounts exist
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, err := utils.GetPasswordHasher().Hash("not-a-real-password")
+	if err != nil {
+		log.Printf("Failed to create dummy password hash: %v", err)
+	}
+	return hash
+})
+
+// checkDummyPassword spends the time of a password check without a user
+func checkDummyPassword(password string) {
+	utils.VerifyPassword(dummyPasswordHash(), password)
+}
+
+// recordLoginAttempt stores a login attempt; failures to record are only logged
+func recordLoginAttempt(c *gin.Context, user *models.User, username string, success bool, reason string) {
+	attempt := models.LoginAttempt{
+		Username:  username,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Success:   success,
+		Reason:    reason,
+	}
+	if user != nil {
+		attempt.UserID = &user.ID
+	}
+	if err := database.DB.Create(&attempt).Error; err != nil {
+		log.Printf("Failed to record login attempt for %q: %v", username, err)
+	}
+}
+
+// countFailedLogin counts a failed attempt for a user locked in the
+// transaction and locks the account once the threshold is reached
+func countFailedLogin(tx *gorm.DB, user *models.User, now time.Time) error {
+	updates := map[string]interface{}{
+		"failed_logins":        user.FailedLogins + 1,
+		"last_failed_login_at": now,
+	}
+	if user.FailedLogins+1 >= loginLockoutThreshold() {
+		updates["locked_until"] = now.Add(loginLockoutDuration())
+		updates["failed_logins"] = 0
+	}
+	return tx.Model(user).Updates(updates).Error
+}
+
+// resetFailedLogins records a successful login and clears the failure counter
+func resetFailedLogins(c *gin.Context, user *models.User) {
+	recordLoginAttempt(c, user, user.Username, true, "")
+
+	if user.FailedLogins == 0 && user.LockedUntil == nil {
+		return
+	}
+	if err := database.DB.Model(user).Updates(map[string]interface{}{
+		"failed_logins":        0,
+		"last_failed_login_at": nil,
+		"locked_until":         nil,
+	}).Error; err != nil {
+		log.Printf("Failed to reset failed logins for user %d: %v", user.ID, err)
+	}
+}
+
+// GetLockedAccounts handles GET /admin/locked-accounts
+func (ac *AdminController) GetLockedAccounts(c *gin.Context) {
+	var users []models.User
+	if err := database.DB.Select("id, username, email, failed_logins, locked_until").
+		Where("locked_until > ? OR failed_logins >= ?", time.Now(), loginDelayAfter()).
+		Order("locked_until DESC NULLS LAST, failed_logins DESC").
+		Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch locked accounts",
+		})
+		return
+	}
+
+	response := make([]gin.H, len(users))
+	for i, user := range users {
+		response[i] = gin.H{
+			"id":            user.ID,
+			"username":      user.Username,
+			"email":         user.Email,
+			"failed_logins": user.FailedLogins,
+			"locked_until":  user.LockedUntil,
+			"locked":        user.IsLocked(time.Now()),
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"accounts":       response,
+		"total_accounts": len(response),
+	})
+}
+
+// GetLoginAttempts handles GET /admin/login-attempts
+func (ac *AdminController) GetLoginAttempts(c *gin.Context) {
+	query := database.DB.Order("created_at DESC").Limit(100)
+	if userID, err := strconv.Atoi(c.Query("user_id")); err == nil {
+		query = query.Where("user_id = ?", userID)
+	}
+	if ip := c.Query("ip"); ip != "" {
+		query = query.Where("ip_address = ?", ip)
+	}
+	if c.Query("failed") == "true" {
+		query = query.Where("success = ?", false)
+	}
+
+	var attempts []models.LoginAttempt
+	if err := query.Find(&attempts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch login attempts",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"attempts":       attempts,
+		"total_attempts": len(attempts),
+	})
+}
+
+// UnlockUser handles POST /admin/users/:id/unlock
+func (ac *AdminController) UnlockUser(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Model(user).Updates(map[string]interface{}{
+		"failed_logins":        0,
+		"last_failed_login_at": nil,
+		"locked_until":         nil,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to unlock account",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Account unlocked successfully",
+	})
+}
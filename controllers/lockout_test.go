@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReplayFailedLoginsMatchesAccountLockout(t *testing.T) {
+	t.Setenv("LOGIN_DELAY_AFTER", "3")
+	t.Setenv("LOGIN_LOCKOUT_THRESHOLD", "10")
+	t.Setenv("LOGIN_LOCKOUT_DURATION", "15m")
+	now := time.Now()
+
+	tests := []struct {
+		failures int
+		throttle bool
+		locked   bool
+	}{
+		{failures: 0},
+		{failures: 2},
+		{failures: 3, throttle: true},
+		{failures: 9, throttle: true},
+		{failures: 10, throttle: true, locked: true},
+	}
+	for _, tt := range tests {
+		failures := make([]time.Time, tt.failures)
+		for i := range failures {
+			failures[i] = now.Add(-time.Duration(tt.failures-i) * time.Millisecond)
+		}
+		user := replayFailedLogins(failures)
+		throttle := checkLoginThrottle(&user, now)
+		if (throttle != nil) != tt.throttle {
+			t.Errorf("%d failures: want throttled %v, got %+v", tt.failures, tt.throttle, throttle)
+			continue
+		}
+		if throttle != nil && throttle.locked != tt.locked {
+			t.Errorf("%d failures: want locked %v, got %v", tt.failures, tt.locked, throttle.locked)
+		}
+	}
+}
+
+func TestReplayFailedLoginsExpires(t *testing.T) {
+	t.Setenv("LOGIN_LOCKOUT_THRESHOLD", "10")
+	t.Setenv("LOGIN_LOCKOUT_DURATION", "15m")
+	now := time.Now()
+
+	failures := make([]time.Time, 10)
+	for i := range failures {
+		failures[i] = now.Add(-time.Hour)
+	}
+	user := replayFailedLogins(failures)
+	if throttle := checkLoginThrottle(&user, now); throttle != nil {
+		t.Fatalf("want the lockout to have expired, got %+v", throttle)
+	}
+}
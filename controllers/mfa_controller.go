@@ -0,0 +1,471 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thelostleo/CTF-backend/database"
+	"github.com/thelostleo/CTF-backend/middleware"
+	"github.com/thelostleo/CTF-backend/models"
+	"github.com/thelostleo/CTF-backend/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type MFAController struct{}
+
+// recoveryCodeCount is how many recovery codes are issued at a time
+const recoveryCodeCount = 10
+
+var (
+	errInvalidSecondFactor = errors.New("invalid two-factor code")
+	errInvalidMFAToken     = errors.New("invalid two-factor login token")
+	errAlreadyEnabled      = errors.New("two-factor authentication already enabled")
+	errNotEnrolled         = errors.New("two-factor authentication not enrolled")
+)
+
+// normalizeRecoveryCode strips formatting so codes can be typed loosely
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// generateRecoveryCodes replaces the user's recovery codes and returns the new plaintext codes
+func generateRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	records := make([]models.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		token, err := utils.GenerateRandomToken(5)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = token[:5] + "-" + token[5:]
+		records[i] = models.RecoveryCode{UserID: userID, CodeHash: utils.HashToken(token)}
+	}
+
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// verifySecondFactor checks a TOTP or recovery code for a user locked in the
+// transaction, consuming the code so it cannot be used again
+func verifySecondFactor(tx *gorm.DB, user *models.User, code string) error {
+	secret, err := utils.DecryptTOTPSecret(user.TOTPSecret)
+	if err != nil {
+		return err
+	}
+
+	if counter, ok := utils.VerifyTOTPCode(secret, code, time.Now(), user.TOTPLastCounter); ok {
+		user.TOTPLastCounter = counter
+		return tx.Model(user).Update("totp_last_counter", counter).Error
+	}
+
+	// Fall back to a single-use recovery code
+	result := tx.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, utils.HashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInvalidSecondFactor
+	}
+	return nil
+}
+
+// withLockedUser runs fn in a transaction holding a row lock on the user
+func withLockedUser(userID uint, fn func(tx *gorm.DB, user *models.User) error) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			return err
+		}
+		return fn(tx, &user)
+	})
+}
+
+// Enroll handles POST /profile/2fa/enroll
+func (mc *MFAController) Enroll(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	var req struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	// A stolen access token alone must not be enough to bind an authenticator,
+	// and password guesses here count towards the same lockout as /login
+	attempt, err := checkPassword(&user, req.CurrentPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to start enrollment",
+		})
+		return
+	}
+	if attempt.throttle != nil {
+		respondLoginThrottled(c, &user, attempt.throttle)
+		return
+	}
+	if !attempt.ok {
+		recordLoginAttempt(c, &user, user.Username, false, loginFailBadPassword)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Current password is incorrect",
+		})
+		return
+	}
+
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Two-factor authentication is already enabled",
+		})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to generate secret",
+		})
+		return
+	}
+
+	// The secret is sealed with a key derived for TOTP secrets from the flag key
+	sealed, err := utils.EncryptTOTPSecret(secret)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to store secret",
+		})
+		return
+	}
+
+	if err := database.DB.Model(&user).Updates(map[string]interface{}{
+		"totp_secret":       sealed,
+		"totp_last_counter": 0,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to store secret",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Scan the provisioning URI and confirm with a code to enable two-factor authentication",
+		"secret":           secret,
+		"provisioning_uri": utils.TOTPProvisioningURI(user.Username, secret),
+	})
+}
+
+// Confirm handles POST /profile/2fa/confirm
+func (mc *MFAController) Confirm(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var codes []string
+	err := withLockedUser(userID.(uint), func(tx *gorm.DB, user *models.User) error {
+		if user.TOTPEnabled {
+			return errAlreadyEnabled
+		}
+		if user.TOTPSecret == "" {
+			return errNotEnrolled
+		}
+
+		// Only TOTP codes prove the authenticator app was set up
+		secret, err := utils.DecryptTOTPSecret(user.TOTPSecret)
+		if err != nil {
+			return err
+		}
+		counter, ok := utils.VerifyTOTPCode(secret, req.Code, time.Now(), user.TOTPLastCounter)
+		if !ok {
+			return errInvalidSecondFactor
+		}
+
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"totp_enabled":      true,
+			"totp_last_counter": counter,
+		}).Error; err != nil {
+			return err
+		}
+
+		// The code just checked counts as this session's second factor
+		if err := tx.Model(&models.Session{}).Where("id = ? AND user_id = ?", c.GetUint("sessionID"), user.ID).
+			Update("mfa_verified", true).Error; err != nil {
+			return err
+		}
+
+		codes, err = generateRecoveryCodes(tx, user.ID)
+		return err
+	})
+	switch {
+	case errors.Is(err, errAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Two-factor authentication is already enabled",
+		})
+		return
+	case errors.Is(err, errNotEnrolled):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Start enrollment first",
+		})
+		return
+	case errors.Is(err, errInvalidSecondFactor):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid two-factor code",
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to enable two-factor authentication",
+		})
+		return
+	}
+
+	middleware.InvalidateUserCache(userID.(uint))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled. Store the recovery codes somewhere safe; they are shown only once.",
+		"recovery_codes": codes,
+	})
+}
+
+// Disable handles POST /profile/2fa/disable
+func (mc *MFAController) Disable(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	var req struct {
+		Code string `json:"code" binding:"required"` // TOTP or recovery code
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	err := withLockedUser(userID.(uint), func(tx *gorm.DB, user *models.User) error {
+		if !user.TOTPEnabled {
+			return errNotEnrolled
+		}
+		if err := verifySecondFactor(tx, user, req.Code); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(user).Updates(map[string]interface{}{
+			"totp_enabled":      false,
+			"totp_secret":       "",
+			"totp_last_counter": 0,
+		}).Error
+	})
+	switch {
+	case errors.Is(err, errNotEnrolled):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Two-factor authentication is not enabled",
+		})
+		return
+	case errors.Is(err, errInvalidSecondFactor):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid two-factor code",
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to disable two-factor authentication",
+		})
+		return
+	}
+
+	middleware.InvalidateUserCache(userID.(uint))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// RegenerateRecoveryCodes handles POST /profile/2fa/recovery-codes
+func (mc *MFAController) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	var req struct {
+		Code string `json:"code" binding:"required"` // TOTP or recovery code
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var codes []string
+	err := withLockedUser(userID.(uint), func(tx *gorm.DB, user *models.User) error {
+		if !user.TOTPEnabled {
+			return errNotEnrolled
+		}
+		if err := verifySecondFactor(tx, user, req.Code); err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = generateRecoveryCodes(tx, user.ID)
+		return err
+	})
+	switch {
+	case errors.Is(err, errNotEnrolled):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Two-factor authentication is not enabled",
+		})
+		return
+	case errors.Is(err, errInvalidSecondFactor):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid two-factor code",
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to regenerate recovery codes",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Recovery codes regenerated; previous codes no longer work",
+		"recovery_codes": codes,
+	})
+}
+
+// VerifyLogin handles POST /login/2fa
+func (mc *MFAController) VerifyLogin(c *gin.Context) {
+	var req struct {
+		MFAToken string `json:"mfa_token" binding:"required"`
+		Code     string `json:"code" binding:"required"` // TOTP or recovery code
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	claims, err := utils.ValidateMFAPendingToken(req.MFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Invalid or expired two-factor login token",
+		})
+		return
+	}
+
+	// Code guesses count towards the same lockout as password guesses, checked
+	// and counted under the user row lock
+	var user models.User
+	var throttle *loginThrottle
+	var failed bool
+	err = withLockedUser(claims.UserID, func(tx *gorm.DB, locked *models.User) error {
+		user = *locked
+		if claims.Version != user.TokenVersion || !user.TOTPEnabled {
+			return errInvalidMFAToken
+		}
+		now := time.Now()
+		if throttle = checkLoginThrottle(&user, now); throttle != nil {
+			return nil
+		}
+		if user.IsBlocked(now) {
+			return errAccountBlocked
+		}
+		err := verifySecondFactor(tx, &user, req.Code)
+		if errors.Is(err, errInvalidSecondFactor) {
+			failed = true
+			return countFailedLogin(tx, &user, now)
+		}
+		return err
+	})
+	switch {
+	case errors.Is(err, errAccountBlocked):
+		c.JSON(http.StatusForbidden, blockedAccountResponse(&user))
+		return
+	case err != nil:
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Invalid or expired two-factor login token",
+		})
+		return
+	case throttle != nil:
+		respondLoginThrottled(c, &user, throttle)
+		return
+	case failed:
+		recordLoginAttempt(c, &user, user.Username, false, loginFailBadSecondStep)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Invalid two-factor code",
+		})
+		return
+	}
+
+	resetFailedLogins(c, &user)
+
+	tokens, err := issueSession(c, &user, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to generate token",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens.apply(loginResponse(&user)))
+}
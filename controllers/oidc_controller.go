@@ -0,0 +1,287 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thelostleo/CTF-backend/database"
+	"github.com/thelostleo/CTF-backend/middleware"
+	"github.com/thelostleo/CTF-backend/models"
+	"github.com/thelostleo/CTF-backend/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OIDCController struct{}
+
+// oauthStateTTL is how long a started OpenID Connect login may take
+const oauthStateTTL = 10 * time.Minute
+
+var (
+	errInvalidOAuthState    = errors.New("invalid or expired login state")
+	errOIDCEmailUnverified  = errors.New("identity provider did not return a verified email")
+	usernameDisallowedChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+)
+
+// consumeOAuthState deletes a pending login and returns it if it is still valid
+func consumeOAuthState(providerName, state string) (*models.OAuthState, error) {
+	var oauthState models.OAuthState
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("state_hash = ? AND provider = ?", utils.HashToken(state), providerName).
+			First(&oauthState).Error; err != nil {
+			return errInvalidOAuthState
+		}
+		return tx.Delete(&oauthState).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(oauthState.ExpiresAt) {
+		return nil, errInvalidOAuthState
+	}
+	return &oauthState, nil
+}
+
+// uniqueUsername derives an unused username from the identity claims
+func uniqueUsername(tx *gorm.DB, claims *utils.OIDCClaims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	base = usernameDisallowedChars.ReplaceAllString(base, "")
+	if len(base) < 3 || isReservedUsername(base) {
+		base = "player"
+	}
+	if len(base) > 40 {
+		base = base[:40]
+	}
+
+	candidate := base
+	for i := 2; ; i++ {
+		var count int64
+		if err := tx.Unscoped().Model(&models.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s%d", base, i)
+	}
+}
+
+// findOrCreateOIDCUser returns the user linked to the identity, linking an
+// existing account by verified email or creating a new one
+func findOrCreateOIDCUser(providerName string, claims *utils.OIDCClaims) (*models.User, error) {
+	var user models.User
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var identity models.UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", providerName, claims.Subject).First(&identity).Error
+		if err == nil {
+			return tx.First(&user, identity.UserID).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// Accounts are only matched by an address the provider vouches for
+		if claims.Email == "" || !claims.EmailVerified {
+			return errOIDCEmailUnverified
+		}
+
+		// Local accounts get an unusable password; one can be set via password reset
+		randomPassword, err := utils.GenerateRandomToken(32)
+		if err != nil {
+			return err
+		}
+		hashedPassword, err := utils.HashPassword(randomPassword)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("LOWER(email) = LOWER(?)", claims.Email).First(&user).Error
+		switch {
+		case err == nil && !user.EmailVerified:
+			// Nobody proved owning this address before, so whoever registered it
+			// loses access: the provider just proved the address belongs to someone else
+			if err := tx.Model(&user).Updates(map[string]interface{}{
+				"password":       hashedPassword,
+				"email_verified": true,
+				"token_version":  gorm.Expr("token_version + 1"),
+			}).Error; err != nil {
+				return err
+			}
+			if _, err := revokeSessions(tx, user.ID); err != nil {
+				return err
+			}
+			if err := tx.First(&user, user.ID).Error; err != nil {
+				return err
+			}
+		case err == nil:
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			username, err := uniqueUsername(tx, claims)
+			if err != nil {
+				return err
+			}
+			user = models.User{
+				Username:      username,
+				Email:         claims.Email,
+				Password:      hashedPassword,
+				EmailVerified: true,
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		return tx.Create(&models.UserIdentity{
+			UserID:   user.ID,
+			Provider: providerName,
+			Subject:  claims.Subject,
+			Email:    claims.Email,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	middleware.InvalidateUserCache(user.ID)
+	return &user, nil
+}
+
+// GetProviders handles GET /auth/oidc/providers
+func (oc *OIDCController) GetProviders(c *gin.Context) {
+	providers := []gin.H{}
+	for _, provider := range utils.GetOIDCProviders() {
+		providers = append(providers, gin.H{
+			"name":         provider.Name,
+			"display_name": provider.DisplayName,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"providers": providers,
+	})
+}
+
+// StartLogin handles GET /auth/oidc/:provider/login
+func (oc *OIDCController) StartLogin(c *gin.Context) {
+	provider, ok := utils.GetOIDCProvider(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Unknown identity provider",
+		})
+		return
+	}
+
+	state, errState := utils.GenerateRandomToken(32)
+	nonce, errNonce := utils.GenerateRandomToken(16)
+	verifier, challenge, errPKCE := utils.GeneratePKCE()
+	if err := errors.Join(errState, errNonce, errPKCE); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to start login",
+		})
+		return
+	}
+
+	authorizationURL, err := provider.AuthorizationURL(state, nonce, challenge)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":   "Identity provider is unavailable",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	oauthState := models.OAuthState{
+		StateHash:    utils.HashToken(state),
+		Provider:     provider.Name,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().Add(oauthStateTTL),
+	}
+	if err := database.DB.Create(&oauthState).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to start login",
+		})
+		return
+	}
+
+	// Clean up logins that were never completed
+	database.DB.Where("expires_at < ?", time.Now()).Delete(&models.OAuthState{})
+
+	c.JSON(http.StatusOK, gin.H{
+		"authorization_url": authorizationURL,
+		"state":             state,
+	})
+}
+
+// Callback handles POST /auth/oidc/:provider/callback
+func (oc *OIDCController) Callback(c *gin.Context) {
+	provider, ok := utils.GetOIDCProvider(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Unknown identity provider",
+		})
+		return
+	}
+
+	var req struct {
+		Code  string `json:"code" binding:"required"`
+		State string `json:"state" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	oauthState, err := consumeOAuthState(provider.Name, req.State)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid or expired login state",
+		})
+		return
+	}
+
+	claims, err := provider.Exchange(req.Code, oauthState.CodeVerifier, oauthState.Nonce)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Identity provider login failed",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	user, err := findOrCreateOIDCUser(provider.Name, claims)
+	if errors.Is(err, errOIDCEmailUnverified) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Your identity provider account has no verified email address",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to sign in",
+		})
+		return
+	}
+
+	if user.IsBlocked(time.Now()) {
+		c.JSON(http.StatusForbidden, blockedAccountResponse(user))
+		return
+	}
+
+	completeLogin(c, user)
+}
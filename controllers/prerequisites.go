@@ -0,0 +1,510 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thelostleo/CTF-backend/database"
+	"github.com/thelostleo/CTF-backend/models"
+	"gorm.io/gorm"
+)
+
+// errChallengeLocked is returned when a challenge's prerequisites are not met
+var errChallengeLocked = errors.New("challenge is locked")
+
+// solveProgress is what a player (or their team in team mode) has solved,
+// against which prerequisites are evaluated
+type solveProgress struct {
+	solved         map[uint]bool
+	categoryPoints map[string]int
+}
+
+// viewerOf returns the authenticated user of the request, or nil for anonymous viewers
+func viewerOf(c *gin.Context) *models.User {
+	userID, exists := c.Get("userID")
+	if !exists {
+		return nil
+	}
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		return nil
+	}
+	return &user
+}
+
+// loadSolveProgress collects the solved challenges and points per category of
+// the user, or of their team in team mode; anonymous viewers have solved nothing
+func loadSolveProgress(db *gorm.DB, user *models.User) (*solveProgress, error) {
+	progress := &solveProgress{
+		solved:         make(map[uint]bool),
+		categoryPoints: make(map[string]int),
+	}
+	if user == nil {
+		return progress, nil
+	}
+
+	solves := db.Model(&models.Submission{}).Select("challenge_id").Where("is_correct = ?", true)
+	if teamModeEnabled() && user.TeamID != nil {
+		solves = solves.Where("team_id = ?", *user.TeamID)
+	} else {
+		solves = solves.Where("user_id = ?", user.ID)
+	}
+
+	var challenges []models.Challenge
+	if err := db.Select("id, category, points").Where("id IN (?)", solves).Find(&challenges).Error; err != nil {
+		return nil, err
+	}
+	for _, challenge := range challenges {
+		progress.solved[challenge.ID] = true
+		progress.categoryPoints[challenge.Category] += challenge.Points
+	}
+	return progress, nil
+}
+
+// met reports whether a single prerequisite is satisfied
+func (p *solveProgress) met(prerequisite *models.ChallengePrerequisite) bool {
+	switch prerequisite.Type {
+	case models.PrerequisiteChallenge:
+		return prerequisite.RequiredChallengeID != nil && p.solved[*prerequisite.RequiredChallengeID]
+	case models.PrerequisiteCategoryPoints:
+		return p.categoryPoints[prerequisite.Category] >= prerequisite.MinPoints
+	}
+	return false
+}
+
+// unlocked reports whether the challenge is solved already or all its prerequisites are met
+func (p *solveProgress) unlocked(challenge *models.Challenge) bool {
+	if p.solved[challenge.ID] {
+		return true
+	}
+	for i := range challenge.Prerequisites {
+		if !p.met(&challenge.Prerequisites[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// applyPrerequisites drops challenges the viewer has not unlocked, or strips
+// their content and marks them locked when they are shown while locked.
+// The challenges must have their prerequisites preloaded.
+func applyPrerequisites(challenges []models.Challenge, progress *solveProgress) []models.Challenge {
+	visible := challenges[:0]
+	for _, challenge := range challenges {
+		if !progress.unlocked(&challenge) {
+			if challenge.LockedVisibility != models.LockedShown {
+				continue
+			}
+			challenge.Locked = true
+			challenge.Description = ""
+			challenge.FileURL = ""
+			challenge.Hints = nil
+			challenge.Files = nil
+		}
+		visible = append(visible, challenge)
+	}
+	return visible
+}
+
+// challengeLocked reports whether the user has not unlocked the challenge yet
+func challengeLocked(db *gorm.DB, user *models.User, challengeID uint) (bool, error) {
+	challenge := models.Challenge{ID: challengeID}
+	if err := db.Where("challenge_id = ?", challengeID).Find(&challenge.Prerequisites).Error; err != nil {
+		return false, err
+	}
+	if len(challenge.Prerequisites) == 0 {
+		return false, nil
+	}
+
+	progress, err := loadSolveProgress(db, user)
+	if err != nil {
+		return false, err
+	}
+	return !progress.unlocked(&challenge), nil
+}
+
+// challengeGraph describes challenges as nodes and their prerequisites as
+// edges. With progress nil (the admin view) nodes carry no solved state and
+// edges to challenges outside the list are kept.
+func challengeGraph(challenges []models.Challenge, progress *solveProgress) gin.H {
+	listed := make(map[uint]bool, len(challenges))
+	for _, challenge := range challenges {
+		listed[challenge.ID] = true
+	}
+
+	nodes := make([]gin.H, 0, len(challenges))
+	edges := []gin.H{}
+	for _, challenge := range challenges {
+		node := gin.H{
+			"id":       challenge.ID,
+			"title":    challenge.Title,
+			"category": challenge.Category,
+			"points":   challenge.Points,
+		}
+		if progress != nil {
+			node["solved"] = progress.solved[challenge.ID]
+			node["locked"] = challenge.Locked
+		} else {
+			node["is_active"] = challenge.IsActive
+			node["locked_visibility"] = challenge.LockedVisibility
+		}
+		nodes = append(nodes, node)
+
+		for _, prerequisite := range challenge.Prerequisites {
+			edge := gin.H{
+				"type": prerequisite.Type,
+				"to":   challenge.ID,
+			}
+			switch prerequisite.Type {
+			case models.PrerequisiteChallenge:
+				// Players must not learn about challenges hidden from them
+				if progress != nil && !listed[*prerequisite.RequiredChallengeID] {
+					continue
+				}
+				edge["from"] = *prerequisite.RequiredChallengeID
+			case models.PrerequisiteCategoryPoints:
+				edge["category"] = prerequisite.Category
+				edge["min_points"] = prerequisite.MinPoints
+			}
+			if progress != nil {
+				edge["met"] = progress.met(&prerequisite)
+			}
+			edges = append(edges, edge)
+		}
+	}
+
+	return gin.H{
+		"nodes": nodes,
+		"edges": edges,
+	}
+}
+
+// prerequisiteGraph loads every challenge-to-challenge prerequisite as a map
+// from a challenge to the challenges it requires
+func prerequisiteGraph(tx *gorm.DB) (map[uint][]uint, error) {
+	var prerequisites []models.ChallengePrerequisite
+	if err := tx.Where("type = ?", models.PrerequisiteChallenge).Find(&prerequisites).Error; err != nil {
+		return nil, err
+	}
+
+	graph := make(map[uint][]uint)
+	for _, prerequisite := range prerequisites {
+		graph[prerequisite.ChallengeID] = append(graph[prerequisite.ChallengeID], *prerequisite.RequiredChallengeID)
+	}
+	return graph, nil
+}
+
+// findPrerequisiteCycle returns the challenges forming a cycle through the
+// given challenge, starting and ending with it, or nil if there is none
+func findPrerequisiteCycle(graph map[uint][]uint, challengeID uint) []uint {
+	visited := make(map[uint]bool)
+	var path []uint
+
+	var visit func(node uint) bool
+	visit = func(node uint) bool {
+		path = append(path, node)
+		for _, required := range graph[node] {
+			if required == challengeID {
+				path = append(path, required)
+				return true
+			}
+			if !visited[required] {
+				visited[required] = true
+				if visit(required) {
+					return true
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+
+	if visit(challengeID) {
+		return path
+	}
+	return nil
+}
+
+// formatCycle renders a prerequisite cycle such as "3 -> 5 -> 3"
+func formatCycle(cycle []uint) string {
+	parts := make([]string, len(cycle))
+	for i, id := range cycle {
+		parts[i] = fmt.Sprint(id)
+	}
+	return strings.Join(parts, " -> ")
+}
+
+// dependentsOf returns every challenge that directly or transitively requires the given one
+func dependentsOf(graph map[uint][]uint, challengeID uint) map[uint]bool {
+	requiredBy := make(map[uint][]uint)
+	for challenge, requirements := range graph {
+		for _, required := range requirements {
+			requiredBy[required] = append(requiredBy[required], challenge)
+		}
+	}
+
+	dependents := make(map[uint]bool)
+	queue := []uint{challengeID}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, dependent := range requiredBy[current] {
+			if !dependents[dependent] {
+				dependents[dependent] = true
+				queue = append(queue, dependent)
+			}
+		}
+	}
+	return dependents
+}
+
+// reachableCategoryPoints returns the points a player can be sure to earn in a
+// category without solving the given challenge first. Dynamic challenges count
+// with their minimum value since their value only decreases.
+func reachableCategoryPoints(tx *gorm.DB, graph map[uint][]uint, challengeID uint, category string) (int, error) {
+	var challenges []models.Challenge
+	if err := tx.Select("id, points, scoring_type, minimum_points").
+		Where("category = ? AND is_active = ? AND id <> ?", category, true, challengeID).
+		Find(&challenges).Error; err != nil {
+		return 0, err
+	}
+
+	dependents := dependentsOf(graph, challengeID)
+	total := 0
+	for _, challenge := range challenges {
+		if dependents[challenge.ID] {
+			continue
+		}
+		if challenge.IsDynamic() {
+			total += challenge.MinimumPoints
+		} else {
+			total += challenge.Points
+		}
+	}
+	return total, nil
+}
+
+// loadUnlockGraph loads every challenge with the fields unlockable needs
+func loadUnlockGraph(tx *gorm.DB) ([]models.Challenge, error) {
+	var challenges []models.Challenge
+	if err := tx.Select("id, category, points, scoring_type, minimum_points, is_active").
+		Preload("Prerequisites").
+		Find(&challenges).Error; err != nil {
+		return nil, err
+	}
+	return challenges, nil
+}
+
+// unlockable returns which of the challenges players could ever unlock,
+// starting from nothing solved and solving every active challenge as soon as
+// its prerequisites are met. Dynamic challenges count with their minimum value.
+// Unlike findPrerequisiteCycle this also finds deadlocks through category
+// points, such as two challenges that each require points in the other's
+// category. The challenges must have their prerequisites loaded.
+func unlockable(challenges []models.Challenge) map[uint]bool {
+	progress := &solveProgress{
+		solved:         make(map[uint]bool),
+		categoryPoints: make(map[string]int),
+	}
+	for changed := true; changed; {
+		changed = false
+		for i := range challenges {
+			challenge := &challenges[i]
+			if !challenge.IsActive || progress.solved[challenge.ID] || !progress.unlocked(challenge) {
+				continue
+			}
+			progress.solved[challenge.ID] = true
+			if challenge.IsDynamic() {
+				progress.categoryPoints[challenge.Category] += challenge.MinimumPoints
+			} else {
+				progress.categoryPoints[challenge.Category] += challenge.Points
+			}
+			changed = true
+		}
+	}
+
+	result := make(map[uint]bool, len(challenges))
+	for i := range challenges {
+		result[challenges[i].ID] = progress.unlocked(&challenges[i])
+	}
+	return result
+}
+
+// prerequisiteRequest is the admin input for a challenge prerequisite
+type prerequisiteRequest struct {
+	Type        string `json:"type" binding:"required"`
+	ChallengeID uint   `json:"challenge_id"` // For type challenge
+	Category    string `json:"category"`     // For type category_points
+	MinPoints   int    `json:"min_points"`   // For type category_points
+}
+
+// GetChallengeGraph handles GET /admin/challenges/graph
+func (ac *AdminController) GetChallengeGraph(c *gin.Context) {
+	var challenges []models.Challenge
+	if err := database.DB.Preload("Prerequisites").
+		Order("id ASC").
+		Find(&challenges).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch challenge graph",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, challengeGraph(challenges, nil))
+}
+
+// SetChallengePrerequisites handles PUT /admin/challenges/:id/prerequisites
+func (ac *AdminController) SetChallengePrerequisites(c *gin.Context) {
+	challengeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid challenge ID",
+		})
+		return
+	}
+
+	if !authorizeChallenge(c, uint(challengeID)) {
+		return
+	}
+
+	var req struct {
+		Prerequisites    []prerequisiteRequest `json:"prerequisites" binding:"dive"` // Replaces all prerequisites
+		LockedVisibility string                `json:"locked_visibility" binding:"omitempty,oneof=hidden locked"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	prerequisites := make([]models.ChallengePrerequisite, 0, len(req.Prerequisites))
+	seen := make(map[string]bool)
+	for _, request := range req.Prerequisites {
+		prerequisite := models.ChallengePrerequisite{
+			ChallengeID: uint(challengeID),
+			Type:        request.Type,
+			Category:    request.Category,
+			MinPoints:   request.MinPoints,
+		}
+		if request.ChallengeID != 0 {
+			requiredID := request.ChallengeID
+			prerequisite.RequiredChallengeID = &requiredID
+		}
+		if err := prerequisite.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid prerequisites",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		key := fmt.Sprintf("%s:%d:%s", prerequisite.Type, request.ChallengeID, prerequisite.Category)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		prerequisites = append(prerequisites, prerequisite)
+	}
+
+	var validationErr error
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Serialize graph edits so two concurrent changes cannot form a cycle together
+		if err := tx.Exec("LOCK TABLE challenge_prerequisites IN SHARE ROW EXCLUSIVE MODE").Error; err != nil {
+			return err
+		}
+
+		graph, err := prerequisiteGraph(tx)
+		if err != nil {
+			return err
+		}
+		graph[uint(challengeID)] = nil
+		for _, prerequisite := range prerequisites {
+			if prerequisite.Type != models.PrerequisiteChallenge {
+				continue
+			}
+			var count int64
+			if err := tx.Model(&models.Challenge{}).Where("id = ?", *prerequisite.RequiredChallengeID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				validationErr = fmt.Errorf("challenge %d does not exist", *prerequisite.RequiredChallengeID)
+				return validationErr
+			}
+			graph[uint(challengeID)] = append(graph[uint(challengeID)], *prerequisite.RequiredChallengeID)
+		}
+
+		if cycle := findPrerequisiteCycle(graph, uint(challengeID)); cycle != nil {
+			validationErr = fmt.Errorf("prerequisites would create a cycle: %s", formatCycle(cycle))
+			return validationErr
+		}
+
+		// A points requirement must be reachable without solving this challenge first
+		for _, prerequisite := range prerequisites {
+			if prerequisite.Type != models.PrerequisiteCategoryPoints {
+				continue
+			}
+			reachable, err := reachableCategoryPoints(tx, graph, uint(challengeID), prerequisite.Category)
+			if err != nil {
+				return err
+			}
+			if reachable < prerequisite.MinPoints {
+				validationErr = fmt.Errorf("only %d points in category %q can be earned before this challenge unlocks",
+					reachable, prerequisite.Category)
+				return validationErr
+			}
+		}
+
+		// Points requirements can still deadlock through other categories
+		challenges, err := loadUnlockGraph(tx)
+		if err != nil {
+			return err
+		}
+		for i := range challenges {
+			if challenges[i].ID == uint(challengeID) {
+				challenges[i].Prerequisites = prerequisites
+			}
+		}
+		if !unlockable(challenges)[uint(challengeID)] {
+			validationErr = errors.New("prerequisites can never be met: the challenges they need to be solved first are locked behind this one")
+			return validationErr
+		}
+
+		if err := tx.Where("challenge_id = ?", challengeID).Delete(&models.ChallengePrerequisite{}).Error; err != nil {
+			return err
+		}
+		if len(prerequisites) > 0 {
+			if err := tx.Create(&prerequisites).Error; err != nil {
+				return err
+			}
+		}
+		if req.LockedVisibility != "" {
+			return tx.Model(&models.Challenge{}).Where("id = ?", challengeID).
+				Update("locked_visibility", req.LockedVisibility).Error
+		}
+		return nil
+	})
+	if validationErr != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid prerequisites",
+			"details": validationErr.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update prerequisites",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Prerequisites updated successfully",
+		"prerequisites": prerequisites,
+	})
+}
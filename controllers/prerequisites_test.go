@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/thelostleo/CTF-backend/models"
+)
+
+// requires returns a prerequisite on solving another challenge
+func requires(challengeID uint) models.ChallengePrerequisite {
+	return models.ChallengePrerequisite{Type: models.PrerequisiteChallenge, RequiredChallengeID: &challengeID}
+}
+
+// requiresPoints returns a prerequisite on points in a category
+func requiresPoints(category string, points int) models.ChallengePrerequisite {
+	return models.ChallengePrerequisite{Type: models.PrerequisiteCategoryPoints, Category: category, MinPoints: points}
+}
+
+// testChallenge returns an active static challenge
+func testChallenge(id uint, category string, points int, prerequisites ...models.ChallengePrerequisite) models.Challenge {
+	return models.Challenge{ID: id, Category: category, Points: points, IsActive: true, Prerequisites: prerequisites}
+}
+
+func TestUnlockable(t *testing.T) {
+	tests := []struct {
+		name       string
+		challenges []models.Challenge
+		locked     []uint
+	}{
+		{
+			name: "chain",
+			challenges: []models.Challenge{
+				testChallenge(1, "web", 100),
+				testChallenge(2, "web", 100, requires(1)),
+				testChallenge(3, "web", 100, requiresPoints("web", 200)),
+			},
+		},
+		{
+			name: "category points unlocking a challenge in the same category",
+			challenges: []models.Challenge{
+				testChallenge(1, "web", 100),
+				testChallenge(2, "web", 100, requiresPoints("web", 100)),
+				testChallenge(3, "web", 100, requires(2)),
+			},
+		},
+		{
+			name: "deadlock through two categories",
+			challenges: []models.Challenge{
+				testChallenge(1, "crypto", 100, requiresPoints("web", 100)),
+				testChallenge(2, "web", 100, requiresPoints("crypto", 100)),
+			},
+			locked: []uint{1, 2},
+		},
+		{
+			name: "other points break the category loop",
+			challenges: []models.Challenge{
+				testChallenge(1, "crypto", 100, requiresPoints("web", 100)),
+				testChallenge(2, "web", 100, requiresPoints("crypto", 100)),
+				testChallenge(3, "crypto", 100),
+			},
+		},
+		{
+			name: "deadlock through a challenge and a category",
+			challenges: []models.Challenge{
+				testChallenge(1, "crypto", 100, requires(2)),
+				testChallenge(2, "web", 100, requiresPoints("crypto", 50)),
+			},
+			locked: []uint{1, 2},
+		},
+		{
+			name: "inactive challenges earn no points",
+			challenges: []models.Challenge{
+				{ID: 1, Category: "web", Points: 100},
+				testChallenge(2, "web", 100, requiresPoints("web", 100)),
+			},
+			locked: []uint{2},
+		},
+		{
+			name: "dynamic challenges count with their minimum value",
+			challenges: []models.Challenge{
+				{ID: 1, Category: "web", Points: 500, ScoringType: models.ScoringDynamic, MinimumPoints: 50, IsActive: true},
+				testChallenge(2, "web", 100, requiresPoints("web", 100)),
+			},
+			locked: []uint{2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unlocked := unlockable(tt.challenges)
+			locked := make(map[uint]bool)
+			for _, id := range tt.locked {
+				locked[id] = true
+			}
+			for _, challenge := range tt.challenges {
+				if unlocked[challenge.ID] == locked[challenge.ID] {
+					t.Errorf("challenge %d: want unlockable %v", challenge.ID, !locked[challenge.ID])
+				}
+			}
+		})
+	}
+}
+
+func TestFindPrerequisiteCycle(t *testing.T) {
+	graph := map[uint][]uint{1: {2}, 2: {3}, 3: {1}, 4: {1}}
+	if cycle := findPrerequisiteCycle(graph, 1); formatCycle(cycle) != "1 -> 2 -> 3 -> 1" {
+		t.Fatalf("want cycle 1 -> 2 -> 3 -> 1, got %v", cycle)
+	}
+	if cycle := findPrerequisiteCycle(graph, 4); cycle != nil {
+		t.Fatalf("want no cycle through 4, got %v", cycle)
+	}
+}
@@ -0,0 +1,461 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thelostleo/CTF-backend/database"
+	"github.com/thelostleo/CTF-backend/models"
+	"gorm.io/gorm"
+)
+
+// releasedChallenges limits a query on challenges to those players can see
+// right now: active, past their release time, in a live wave (if any) and not
+// yet hidden
+func releasedChallenges(db *gorm.DB) *gorm.DB {
+	now := time.Now()
+	liveWaves := db.Session(&gorm.Session{NewDB: true}).
+		Model(&models.ReleaseWave{}).
+		Select("id").
+		Where("released_at IS NOT NULL OR release_at <= ?", now)
+
+	return db.Where("challenges.is_active = ?", true).
+		Where("challenges.release_at IS NULL OR challenges.release_at <= ?", now).
+		Where("challenges.hide_at IS NULL OR challenges.hide_at > ?", now).
+		Where("challenges.wave_id IS NULL OR challenges.wave_id IN (?)", liveWaves)
+}
+
+// validateSchedule checks the release window of a challenge and that its wave exists
+func validateSchedule(db *gorm.DB, releaseAt, hideAt *time.Time, waveID *uint) error {
+	if releaseAt != nil && hideAt != nil && !hideAt.After(*releaseAt) {
+		return errors.New("hide_at must be after release_at")
+	}
+	if waveID != nil {
+		var count int64
+		if err := db.Model(&models.ReleaseWave{}).Where("id = ?", *waveID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return fmt.Errorf("release wave %d does not exist", *waveID)
+		}
+	}
+	return nil
+}
+
+// releaseWave marks a wave as released and announces it. It returns false
+// when the wave had already been released, e.g. by another instance.
+func releaseWave(tx *gorm.DB, wave *models.ReleaseWave, now time.Time) (bool, error) {
+	updates := map[string]interface{}{"released_at": now}
+	if wave.ReleaseAt == nil || wave.ReleaseAt.After(now) {
+		updates["release_at"] = now
+	}
+
+	result := tx.Model(&models.ReleaseWave{}).
+		Where("id = ? AND released_at IS NULL", wave.ID).
+		Updates(updates)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+
+	var challenges int64
+	if err := tx.Model(&models.Challenge{}).
+		Where("wave_id = ? AND is_active = ?", wave.ID, true).
+		Count(&challenges).Error; err != nil {
+		return false, err
+	}
+
+	announcement := models.Announcement{
+		Title:   fmt.Sprintf("%s is live", wave.Name),
+		Content: fmt.Sprintf("%d new challenge(s) have been released.", challenges),
+		WaveID:  &wave.ID,
+	}
+	if err := tx.Create(&announcement).Error; err != nil {
+		return false, err
+	}
+
+	wave.ReleasedAt = &now
+	if _, ok := updates["release_at"]; ok {
+		wave.ReleaseAt = &now
+	}
+	return true, nil
+}
+
+// releaseDueWaves announces every scheduled wave whose release time has passed
+func releaseDueWaves() {
+	now := time.Now()
+
+	var waves []models.ReleaseWave
+	if err := database.DB.Where("released_at IS NULL AND release_at <= ?", now).
+		Order("release_at ASC").
+		Find(&waves).Error; err != nil {
+		log.Printf("Failed to load due release waves: %v", err)
+		return
+	}
+
+	for i := range waves {
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			_, err := releaseWave(tx, &waves[i], now)
+			return err
+		})
+		if err != nil {
+			log.Printf("Failed to release wave %q: %v", waves[i].Name, err)
+		}
+	}
+}
+
+// StartReleaseScheduler periodically announces release waves that are due.
+// Challenges become visible at their release time regardless; the scheduler
+// only records the release and emits the announcement.
+func StartReleaseScheduler(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			releaseDueWaves()
+		}
+	}()
+}
+
+// SetChallengeSchedule handles PUT /admin/challenges/:id/schedule
+func (ac *AdminController) SetChallengeSchedule(c *gin.Context) {
+	challengeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid challenge ID",
+		})
+		return
+	}
+
+	if !authorizeChallenge(c, uint(challengeID)) {
+		return
+	}
+
+	// Replaces the whole schedule; omitted or null fields are cleared
+	var req struct {
+		ReleaseAt *time.Time `json:"release_at"`
+		HideAt    *time.Time `json:"hide_at"`
+		WaveID    *uint      `json:"wave_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if err := validateSchedule(database.DB, req.ReleaseAt, req.HideAt, req.WaveID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid release schedule",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if err := database.DB.Model(&models.Challenge{}).Where("id = ?", challengeID).
+		Updates(map[string]interface{}{
+			"release_at": req.ReleaseAt,
+			"hide_at":    req.HideAt,
+			"wave_id":    req.WaveID,
+		}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update release schedule",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Release schedule updated successfully",
+		"schedule": gin.H{
+			"release_at": req.ReleaseAt,
+			"hide_at":    req.HideAt,
+			"wave_id":    req.WaveID,
+		},
+	})
+}
+
+// findWaveParam loads the release wave referenced by the :id route parameter,
+// writing an error response when it is invalid or missing
+func findWaveParam(c *gin.Context) (*models.ReleaseWave, bool) {
+	waveID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid wave ID",
+		})
+		return nil, false
+	}
+
+	var wave models.ReleaseWave
+	if err := database.DB.First(&wave, waveID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Release wave not found",
+		})
+		return nil, false
+	}
+	return &wave, true
+}
+
+// assignWaveChallenges makes the given challenges the members of a wave
+func assignWaveChallenges(tx *gorm.DB, waveID uint, challengeIDs []uint) error {
+	if err := tx.Model(&models.Challenge{}).Where("wave_id = ?", waveID).
+		Update("wave_id", nil).Error; err != nil {
+		return err
+	}
+	if len(challengeIDs) == 0 {
+		return nil
+	}
+	return tx.Model(&models.Challenge{}).Where("id IN ?", challengeIDs).
+		Update("wave_id", waveID).Error
+}
+
+// waveResponse describes a wave with its member challenges
+func waveResponse(wave *models.ReleaseWave, challenges []models.Challenge) gin.H {
+	members := make([]gin.H, len(challenges))
+	for i, challenge := range challenges {
+		members[i] = gin.H{
+			"id":        challenge.ID,
+			"title":     challenge.Title,
+			"category":  challenge.Category,
+			"is_active": challenge.IsActive,
+		}
+	}
+	return gin.H{
+		"id":          wave.ID,
+		"name":        wave.Name,
+		"release_at":  wave.ReleaseAt,
+		"released_at": wave.ReleasedAt,
+		"live":        wave.IsLive(time.Now()),
+		"challenges":  members,
+	}
+}
+
+// GetWaves handles GET /admin/waves
+func (ac *AdminController) GetWaves(c *gin.Context) {
+	var waves []models.ReleaseWave
+	if err := database.DB.Order("release_at ASC NULLS LAST, id ASC").Find(&waves).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch release waves",
+		})
+		return
+	}
+
+	var challenges []models.Challenge
+	if err := database.DB.Select("id, title, category, is_active, wave_id").
+		Where("wave_id IS NOT NULL").
+		Order("id ASC").
+		Find(&challenges).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch release waves",
+		})
+		return
+	}
+	byWave := make(map[uint][]models.Challenge)
+	for _, challenge := range challenges {
+		byWave[*challenge.WaveID] = append(byWave[*challenge.WaveID], challenge)
+	}
+
+	response := make([]gin.H, len(waves))
+	for i := range waves {
+		response[i] = waveResponse(&waves[i], byWave[waves[i].ID])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"waves":       response,
+		"total_waves": len(response),
+	})
+}
+
+// CreateWave handles POST /admin/waves
+func (ac *AdminController) CreateWave(c *gin.Context) {
+	var req struct {
+		Name         string     `json:"name" binding:"required,max=100"`
+		ReleaseAt    *time.Time `json:"release_at"`
+		ChallengeIDs []uint     `json:"challenge_ids"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	wave := models.ReleaseWave{
+		Name:      req.Name,
+		ReleaseAt: req.ReleaseAt,
+	}
+	var challenges []models.Challenge
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&wave).Error; err != nil {
+			return err
+		}
+		if err := assignWaveChallenges(tx, wave.ID, req.ChallengeIDs); err != nil {
+			return err
+		}
+		return tx.Where("wave_id = ?", wave.ID).Order("id ASC").Find(&challenges).Error
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "A release wave with this name already exists",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create release wave",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Release wave created successfully",
+		"wave":    waveResponse(&wave, challenges),
+	})
+}
+
+// UpdateWave handles PUT /admin/waves/:id
+func (ac *AdminController) UpdateWave(c *gin.Context) {
+	wave, ok := findWaveParam(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name         string     `json:"name" binding:"max=100"`
+		ReleaseAt    *time.Time `json:"release_at"`
+		ChallengeIDs []uint     `json:"challenge_ids"` // Replaces the members when present
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	updates := make(map[string]interface{})
+	if req.Name != "" {
+		updates["name"] = req.Name
+	}
+	if req.ReleaseAt != nil {
+		if wave.ReleasedAt != nil {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "This wave has already been released",
+			})
+			return
+		}
+		updates["release_at"] = req.ReleaseAt
+	}
+
+	var challenges []models.Challenge
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if len(updates) > 0 {
+			if err := tx.Model(wave).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if req.ChallengeIDs != nil {
+			if err := assignWaveChallenges(tx, wave.ID, req.ChallengeIDs); err != nil {
+				return err
+			}
+		}
+		return tx.Where("wave_id = ?", wave.ID).Order("id ASC").Find(&challenges).Error
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "A release wave with this name already exists",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update release wave",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Release wave updated successfully",
+		"wave":    waveResponse(wave, challenges),
+	})
+}
+
+// ReleaseWave handles POST /admin/waves/:id/release
+func (ac *AdminController) ReleaseWave(c *gin.Context) {
+	wave, ok := findWaveParam(c)
+	if !ok {
+		return
+	}
+
+	var released bool
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		released, err = releaseWave(tx, wave, time.Now())
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to release wave",
+		})
+		return
+	}
+	if !released {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "This wave has already been released",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Release wave is now live",
+		"wave":    waveResponse(wave, nil),
+	})
+}
+
+// DeleteWave handles DELETE /admin/waves/:id
+func (ac *AdminController) DeleteWave(c *gin.Context) {
+	wave, ok := findWaveParam(c)
+	if !ok {
+		return
+	}
+
+	// Removing an unreleased wave would publish its challenges at once
+	if !wave.IsLive(time.Now()) {
+		var members int64
+		if err := database.DB.Model(&models.Challenge{}).Where("wave_id = ?", wave.ID).Count(&members).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to delete release wave",
+			})
+			return
+		}
+		if members > 0 {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "Remove the challenges from this unreleased wave before deleting it",
+			})
+			return
+		}
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Challenge{}).Where("wave_id = ?", wave.ID).
+			Update("wave_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(wave).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to delete release wave",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Release wave deleted successfully",
+	})
+}
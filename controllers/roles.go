@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thelostleo/CTF-backend/database"
+	"github.com/thelostleo/CTF-backend/middleware"
+	"github.com/thelostleo/CTF-backend/models"
+	"gorm.io/gorm"
+)
+
+// GetRoles handles GET /admin/roles
+func (ac *AdminController) GetRoles(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"roles": models.RolePermissions,
+	})
+}
+
+// GetUserRoles handles GET /admin/users/:id/roles
+func (ac *AdminController) GetUserRoles(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Model(user).Association("Roles").Find(&user.Roles); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch roles",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":     user.ID,
+		"roles":       user.RoleNames(),
+		"permissions": user.Permissions(),
+	})
+}
+
+// AssignRole handles POST /admin/users/:id/roles
+func (ac *AdminController) AssignRole(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if !models.IsValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Unknown role",
+		})
+		return
+	}
+
+	// The super-admin role is the IsAdmin flag
+	var err error
+	if req.Role == models.RoleSuperAdmin {
+		err = restrictUser(user.ID, map[string]interface{}{"is_admin": true}, false)
+	} else {
+		err = database.DB.Create(&models.UserRole{
+			UserID:    user.ID,
+			Role:      req.Role,
+			GrantedBy: c.GetUint("userID"),
+		}).Error
+		middleware.InvalidateUserCache(user.ID)
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "User already has this role",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to assign role",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Role assigned successfully",
+	})
+}
+
+// RemoveRole handles DELETE /admin/users/:id/roles/:role
+func (ac *AdminController) RemoveRole(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+
+	role := c.Param("role")
+	if role == models.RoleSuperAdmin {
+		if isSelf(c, user) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "You cannot remove your own admin rights",
+			})
+			return
+		}
+		if err := restrictUser(user.ID, map[string]interface{}{"is_admin": false}, false); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to remove role",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Role removed successfully",
+		})
+		return
+	}
+
+	result := database.DB.Where("user_id = ? AND role = ?", user.ID, role).Delete(&models.UserRole{})
+	middleware.InvalidateUserCache(user.ID)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to remove role",
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "User does not have this role",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Role removed successfully",
+	})
+}
@@ -0,0 +1,294 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/thelostleo/CTF-backend/models"
+	"gorm.io/gorm"
+)
+
+// validateScoring checks the dynamic scoring parameters of a challenge
+func validateScoring(challenge *models.Challenge) error {
+	switch challenge.ScoringType {
+	case "", models.ScoringStatic:
+		challenge.ScoringType = models.ScoringStatic
+		return nil
+	case models.ScoringDynamic:
+	default:
+		return errors.New("scoring_type must be static or dynamic")
+	}
+
+	if challenge.InitialPoints <= 0 {
+		challenge.InitialPoints = challenge.Points
+	}
+	if challenge.MinimumPoints < 0 || challenge.MinimumPoints > challenge.InitialPoints {
+		return errors.New("minimum_points must be between 0 and initial_points")
+	}
+	if challenge.Decay < 1 {
+		return errors.New("decay must be at least 1")
+	}
+	switch challenge.DecayFunction {
+	case "":
+		challenge.DecayFunction = models.DecayLinear
+	case models.DecayLinear, models.DecayLogarithmic:
+	default:
+		return errors.New("decay_function must be linear or logarithmic")
+	}
+	return nil
+}
+
+// userLedgerScore is the SQL expression deriving a user's score from the
+// distinct challenges they solved plus manual awards minus unlocked hints. In
+// team mode a player who moved teams may hold a solve for each team.
+const userLedgerScore = `COALESCE((SELECT SUM(c.points) FROM challenges c
+	WHERE c.deleted_at IS NULL AND c.id IN (SELECT s.challenge_id FROM submissions s
+	WHERE s.user_id = users.id AND s.is_correct AND s.deleted_at IS NULL)), 0) +
+	COALESCE((SELECT SUM(a.value) FROM awards a
+	WHERE a.user_id = users.id AND a.deleted_at IS NULL), 0) -
+	COALESCE((SELECT SUM(h.cost) FROM hint_unlocks h
+	WHERE h.user_id = users.id), 0)`
+
+// teamLedgerScore is the SQL expression deriving a team's score from the
+// distinct challenges its members solved plus manual awards minus unlocked hints
+const teamLedgerScore = `COALESCE((SELECT SUM(c.points) FROM challenges c
+	WHERE c.deleted_at IS NULL AND c.id IN (SELECT s.challenge_id FROM submissions s
+	WHERE s.team_id = teams.id AND s.is_correct AND s.deleted_at IS NULL)), 0) +
+	COALESCE((SELECT SUM(a.value) FROM awards a
+	WHERE a.team_id = teams.id AND a.deleted_at IS NULL), 0) -
+	COALESCE((SELECT SUM(h.cost) FROM hint_unlocks h
+	WHERE h.team_id = teams.id), 0)`
+
+// frozenUserLedgerScore is userLedgerScore restricted to ledger entries
+// before a point in time. %s is the challenge value expression from
+// frozenPointsSQL, followed by the time bound three times.
+const frozenUserLedgerScore = `COALESCE((SELECT SUM(%s) FROM challenges c
+	WHERE c.deleted_at IS NULL AND c.id IN (SELECT s.challenge_id FROM submissions s
+	WHERE s.user_id = users.id AND s.is_correct AND s.deleted_at IS NULL AND s.submitted_at < ?)), 0) +
+	COALESCE((SELECT SUM(a.value) FROM awards a
+	WHERE a.user_id = users.id AND a.deleted_at IS NULL AND a.created_at < ?), 0) -
+	COALESCE((SELECT SUM(h.cost) FROM hint_unlocks h
+	WHERE h.user_id = users.id AND h.created_at < ?), 0)`
+
+// frozenTeamLedgerScore is teamLedgerScore restricted to ledger entries
+// before a point in time, with the same placeholders as frozenUserLedgerScore
+const frozenTeamLedgerScore = `COALESCE((SELECT SUM(%s) FROM challenges c
+	WHERE c.deleted_at IS NULL AND c.id IN (SELECT s.challenge_id FROM submissions s
+	WHERE s.team_id = teams.id AND s.is_correct AND s.deleted_at IS NULL AND s.submitted_at < ?)), 0) +
+	COALESCE((SELECT SUM(a.value) FROM awards a
+	WHERE a.team_id = teams.id AND a.deleted_at IS NULL AND a.created_at < ?), 0) -
+	COALESCE((SELECT SUM(h.cost) FROM hint_unlocks h
+	WHERE h.team_id = teams.id AND h.created_at < ?), 0)`
+
+// frozenChallengeValues returns the value every dynamic challenge had at the
+// freeze time, derived from the solves recorded before it. Dynamic challenges
+// keep decaying afterwards, so their current points cannot be used.
+func frozenChallengeValues(db *gorm.DB, freeze time.Time) (map[uint]int, error) {
+	var challenges []models.Challenge
+	if err := db.Where("scoring_type = ?", models.ScoringDynamic).Find(&challenges).Error; err != nil {
+		return nil, err
+	}
+	if len(challenges) == 0 {
+		return map[uint]int{}, nil
+	}
+
+	var counts []struct {
+		ChallengeID uint
+		Solves      int
+	}
+	if err := db.Model(&models.Submission{}).
+		Select("challenge_id, COUNT(*) AS solves").
+		Where("is_correct = ? AND submitted_at < ?", true, freeze).
+		Group("challenge_id").
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	solves := make(map[uint]int, len(counts))
+	for _, count := range counts {
+		solves[count.ChallengeID] = count.Solves
+	}
+
+	values := make(map[uint]int, len(challenges))
+	for i := range challenges {
+		values[challenges[i].ID] = challenges[i].ValueForSolves(solves[challenges[i].ID])
+	}
+	return values, nil
+}
+
+// frozenPointsSQL returns an expression for the value of challenge c at the
+// freeze time, with its bind values
+func frozenPointsSQL(values map[uint]int) (string, []interface{}) {
+	if len(values) == 0 {
+		return "c.points", nil
+	}
+
+	ids := make([]uint, 0, len(values))
+	for id := range values {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var expr strings.Builder
+	args := make([]interface{}, 0, len(ids)*2)
+	expr.WriteString("CASE c.id")
+	for _, id := range ids {
+		expr.WriteString(" WHEN ? THEN ?")
+		args = append(args, id, values[id])
+	}
+	expr.WriteString(" ELSE c.points END")
+	return expr.String(), args
+}
+
+// frozenLedgerScore builds a frozen ledger expression (frozenUserLedgerScore
+// or frozenTeamLedgerScore) for the freeze time, with its bind values
+func frozenLedgerScore(db *gorm.DB, ledger string, freeze time.Time) (string, []interface{}, error) {
+	values, err := frozenChallengeValues(db, freeze)
+	if err != nil {
+		return "", nil, err
+	}
+	points, args := frozenPointsSQL(values)
+	return fmt.Sprintf(ledger, points), append(args, freeze, freeze, freeze), nil
+}
+
+// ScoreDiscrepancy describes a cached score that differs from the ledger
+type ScoreDiscrepancy struct {
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	Score       int    `json:"score"`
+	LedgerScore int    `json:"ledger_score"`
+}
+
+// syncUserScores rewrites the cached score of the given users from the ledger
+func syncUserScores(tx *gorm.DB, userIDs ...uint) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	return tx.Model(&models.User{}).
+		Where("id IN ?", userIDs).
+		Update("score", gorm.Expr(userLedgerScore)).Error
+}
+
+// syncTeamScores rewrites the cached score of the given teams from the ledger
+func syncTeamScores(tx *gorm.DB, teamIDs ...uint) error {
+	if len(teamIDs) == 0 {
+		return nil
+	}
+	return tx.Model(&models.Team{}).
+		Where("id IN ?", teamIDs).
+		Update("score", gorm.Expr(teamLedgerScore)).Error
+}
+
+// syncSolverScores rewrites the cached scores of everyone who solved a challenge
+func syncSolverScores(tx *gorm.DB, challengeID uint) error {
+	solvers := tx.Model(&models.Submission{}).
+		Select("user_id").
+		Where("challenge_id = ? AND is_correct = ?", challengeID, true)
+	if err := tx.Model(&models.User{}).
+		Where("id IN (?)", solvers).
+		Update("score", gorm.Expr(userLedgerScore)).Error; err != nil {
+		return err
+	}
+
+	solverTeams := tx.Model(&models.Submission{}).
+		Select("team_id").
+		Where("challenge_id = ? AND is_correct = ? AND team_id IS NOT NULL", challengeID, true)
+	return tx.Model(&models.Team{}).
+		Where("id IN (?)", solverTeams).
+		Update("score", gorm.Expr(teamLedgerScore)).Error
+}
+
+// recomputeAllScores rewrites every cached user and team score from the ledger
+// and returns how many rows changed
+func recomputeAllScores(tx *gorm.DB) (int64, int64, error) {
+	users := tx.Model(&models.User{}).
+		Where("score <> "+userLedgerScore).
+		Update("score", gorm.Expr(userLedgerScore))
+	if users.Error != nil {
+		return 0, 0, users.Error
+	}
+
+	teams := tx.Model(&models.Team{}).
+		Where("score <> "+teamLedgerScore).
+		Update("score", gorm.Expr(teamLedgerScore))
+	if teams.Error != nil {
+		return 0, 0, teams.Error
+	}
+
+	return users.RowsAffected, teams.RowsAffected, nil
+}
+
+// SyncScoresFromLedger re-derives dynamic challenge values and cached user and
+// team scores from the ledger; it runs at startup after migrations, which may
+// remove duplicate solves
+func SyncScoresFromLedger(db *gorm.DB) (int64, int64, error) {
+	var usersUpdated, teamsUpdated int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var challenges []models.Challenge
+		if err := tx.Where("scoring_type = ?", models.ScoringDynamic).Find(&challenges).Error; err != nil {
+			return err
+		}
+		for i := range challenges {
+			if err := recalculateChallengeValue(tx, &challenges[i]); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		usersUpdated, teamsUpdated, err = recomputeAllScores(tx)
+		return err
+	})
+	return usersUpdated, teamsUpdated, err
+}
+
+// findScoreDiscrepancies lists users and teams whose cached score differs from the ledger
+func findScoreDiscrepancies(tx *gorm.DB) ([]ScoreDiscrepancy, []ScoreDiscrepancy, error) {
+	var users []ScoreDiscrepancy
+	if err := tx.Model(&models.User{}).
+		Select("id, username AS name, score, (" + userLedgerScore + ") AS ledger_score").
+		Where("score <> " + userLedgerScore).
+		Order("id ASC").
+		Scan(&users).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var teams []ScoreDiscrepancy
+	if err := tx.Model(&models.Team{}).
+		Select("id, name, score, (" + teamLedgerScore + ") AS ledger_score").
+		Where("score <> " + teamLedgerScore).
+		Order("id ASC").
+		Scan(&teams).Error; err != nil {
+		return nil, nil, err
+	}
+
+	return users, teams, nil
+}
+
+// recalculateChallengeValue recomputes a dynamic challenge's value from its
+// solve count and re-derives the score of every user and team that solved it
+func recalculateChallengeValue(tx *gorm.DB, challenge *models.Challenge) error {
+	if !challenge.IsDynamic() {
+		return nil
+	}
+
+	var solves int64
+	if err := tx.Model(&models.Submission{}).
+		Where("challenge_id = ? AND is_correct = ?", challenge.ID, true).
+		Count(&solves).Error; err != nil {
+		return err
+	}
+
+	newValue := challenge.ValueForSolves(int(solves))
+	if newValue == challenge.Points {
+		return nil
+	}
+
+	if err := tx.Model(challenge).Update("points", newValue).Error; err != nil {
+		return err
+	}
+	challenge.Points = newValue
+
+	return syncSolverScores(tx, challenge.ID)
+}
@@ -0,0 +1,316 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thelostleo/CTF-backend/database"
+	"github.com/thelostleo/CTF-backend/models"
+	"github.com/thelostleo/CTF-backend/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SessionController struct{}
+
+var (
+	errInvalidRefreshToken = errors.New("invalid refresh token")
+	errRefreshTokenReuse   = errors.New("refresh token reuse detected")
+	errAccountBlocked      = errors.New("account is banned or suspended")
+)
+
+// tokenPair is the access and refresh token issued for a session
+type tokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	Session      *models.Session
+}
+
+// apply adds the token pair to a response body
+func (tp *tokenPair) apply(response gin.H) gin.H {
+	response["token"] = tp.AccessToken
+	response["refresh_token"] = tp.RefreshToken
+	response["token_type"] = "Bearer"
+	response["expires_in"] = int(utils.GetAccessTokenTTL().Seconds())
+	response["session_id"] = tp.Session.ID
+	return response
+}
+
+// issueSession starts a new session for the user and returns its first token
+// pair. mfaVerified records whether the login passed a second factor.
+func issueSession(c *gin.Context, user *models.User, mfaVerified bool) (*tokenPair, error) {
+	now := time.Now()
+	session := models.Session{
+		UserID:      user.ID,
+		UserAgent:   c.Request.UserAgent(),
+		IPAddress:   c.ClientIP(),
+		MFAVerified: mfaVerified,
+		ExpiresAt:   now.Add(utils.GetRefreshTokenTTL()),
+		LastUsedAt:  now,
+	}
+
+	var refreshToken string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+
+		var err error
+		refreshToken, err = createRefreshToken(tx, &session)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := utils.GenerateJWTToken(user.ID, user.Username, user.IsAdmin, session.ID, user.TokenVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenPair{AccessToken: accessToken, RefreshToken: refreshToken, Session: &session}, nil
+}
+
+// createRefreshToken stores a new refresh token for the session and returns it
+func createRefreshToken(tx *gorm.DB, session *models.Session) (string, error) {
+	token, tokenHash, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	refreshToken := models.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: tokenHash,
+		ExpiresAt: session.ExpiresAt,
+	}
+	if err := tx.Create(&refreshToken).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// rotateRefreshToken exchanges a refresh token for a new token pair. Presenting
+// a token that was already rotated revokes the whole session (token family).
+func rotateRefreshToken(c *gin.Context, presented string) (*tokenPair, error) {
+	now := time.Now()
+	var user models.User
+	var session models.Session
+	var newRefreshToken string
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var refreshToken models.RefreshToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", utils.HashToken(presented)).
+			First(&refreshToken).Error; err != nil {
+			return errInvalidRefreshToken
+		}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&session, refreshToken.SessionID).Error; err != nil {
+			return errInvalidRefreshToken
+		}
+
+		// A rotated token being presented again means it was stolen
+		if refreshToken.UsedAt != nil {
+			return errRefreshTokenReuse
+		}
+
+		if !session.IsActive(now) || now.After(refreshToken.ExpiresAt) {
+			return errInvalidRefreshToken
+		}
+
+		if err := tx.First(&user, session.UserID).Error; err != nil {
+			return errInvalidRefreshToken
+		}
+		if user.IsBlocked(now) {
+			return errAccountBlocked
+		}
+
+		if err := tx.Model(&refreshToken).Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		session.ExpiresAt = now.Add(utils.GetRefreshTokenTTL())
+		session.LastUsedAt = now
+		session.IPAddress = c.ClientIP()
+		session.UserAgent = c.Request.UserAgent()
+		if err := tx.Save(&session).Error; err != nil {
+			return err
+		}
+
+		var err error
+		newRefreshToken, err = createRefreshToken(tx, &session)
+		return err
+	})
+
+	if errors.Is(err, errRefreshTokenReuse) {
+		// Revoke the whole token family outside the rolled-back transaction
+		if err := database.DB.Model(&models.Session{}).
+			Where("id = ? AND revoked_at IS NULL", session.ID).
+			Update("revoked_at", now).Error; err != nil {
+			return nil, err
+		}
+		return nil, errRefreshTokenReuse
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := utils.GenerateJWTToken(user.ID, user.Username, user.IsAdmin, session.ID, user.TokenVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenPair{AccessToken: accessToken, RefreshToken: newRefreshToken, Session: &session}, nil
+}
+
+// blockedAccountResponse describes why a banned or suspended user is refused
+func blockedAccountResponse(user *models.User) gin.H {
+	if user.IsBanned {
+		return gin.H{
+			"error":  "Account is banned",
+			"reason": user.BanReason,
+		}
+	}
+	return gin.H{
+		"error":           "Account is suspended",
+		"reason":          user.BanReason,
+		"suspended_until": user.SuspendedUntil,
+	}
+}
+
+// revokeSessions revokes the given active sessions of a user
+func revokeSessions(tx *gorm.DB, userID uint, sessionIDs ...uint) (int64, error) {
+	query := tx.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if len(sessionIDs) > 0 {
+		query = query.Where("id IN ?", sessionIDs)
+	}
+	result := query.Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// Logout handles POST /logout
+func (sc *SessionController) Logout(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	sessionID := c.GetUint("sessionID")
+	if _, err := revokeSessions(database.DB, userID.(uint), sessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to log out",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Logged out successfully",
+	})
+}
+
+// GetSessions handles GET /sessions
+func (sc *SessionController) GetSessions(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	var sessions []models.Session
+	if err := database.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch sessions",
+		})
+		return
+	}
+
+	currentSessionID := c.GetUint("sessionID")
+	response := make([]gin.H, len(sessions))
+	for i, session := range sessions {
+		response[i] = gin.H{
+			"id":           session.ID,
+			"user_agent":   session.UserAgent,
+			"ip_address":   session.IPAddress,
+			"created_at":   session.CreatedAt,
+			"last_used_at": session.LastUsedAt,
+			"expires_at":   session.ExpiresAt,
+			"current":      session.ID == currentSessionID,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sessions":       response,
+		"total_sessions": len(response),
+	})
+}
+
+// RevokeSession handles DELETE /sessions/:id
+func (sc *SessionController) RevokeSession(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid session ID",
+		})
+		return
+	}
+
+	revoked, err := revokeSessions(database.DB, userID.(uint), uint(sessionID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to revoke session",
+		})
+		return
+	}
+	if revoked == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Session not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Session revoked successfully",
+	})
+}
+
+// RevokeAllSessions handles DELETE /sessions
+func (sc *SessionController) RevokeAllSessions(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	revoked, err := revokeSessions(database.DB, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to revoke sessions",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "All sessions revoked successfully",
+		"revoked_sessions": revoked,
+	})
+}
@@ -0,0 +1,447 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thelostleo/CTF-backend/database"
+	"github.com/thelostleo/CTF-backend/models"
+	"github.com/thelostleo/CTF-backend/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TeamController struct{}
+
+var (
+	errAlreadyInTeam = errors.New("already in a team")
+	errTeamFull      = errors.New("team is full")
+	errNotInTeam     = errors.New("not in a team")
+	errNotCaptain    = errors.New("not the team captain")
+)
+
+// teamModeEnabled reports whether solves and the leaderboard are team-based
+func teamModeEnabled() bool {
+	return utils.GetEnvAsBool("TEAM_MODE", false)
+}
+
+// teamMaxSize returns the maximum number of members per team
+func teamMaxSize() int {
+	return utils.GetEnvAsInt("TEAM_MAX_SIZE", 4)
+}
+
+// generateInviteCode creates a random invite code for a team
+func generateInviteCode() (string, error) {
+	return utils.GenerateRandomToken(8)
+}
+
+// teamResponse builds the team payload shown to its members
+func teamResponse(team *models.Team) gin.H {
+	members := make([]gin.H, len(team.Members))
+	for i, member := range team.Members {
+		members[i] = gin.H{
+			"id":         member.ID,
+			"username":   member.Username,
+			"score":      member.Score,
+			"is_captain": member.ID == team.CaptainID,
+		}
+	}
+
+	return gin.H{
+		"id":          team.ID,
+		"name":        team.Name,
+		"captain_id":  team.CaptainID,
+		"score":       team.Score,
+		"invite_code": team.InviteCode,
+		"members":     members,
+		"max_size":    teamMaxSize(),
+	}
+}
+
+// CreateTeam handles POST /teams
+func (tc *TeamController) CreateTeam(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	var req struct {
+		Name string `json:"name" binding:"required,min=3,max=50"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	// Check if team name already exists
+	var existingTeam models.Team
+	if err := database.DB.Where("name = ?", req.Name).First(&existingTeam).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Team name already exists",
+		})
+		return
+	}
+
+	inviteCode, err := generateInviteCode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create team",
+		})
+		return
+	}
+
+	team := models.Team{
+		Name:       req.Name,
+		InviteCode: inviteCode,
+		CaptainID:  userID.(uint),
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			return err
+		}
+		if user.TeamID != nil {
+			return errAlreadyInTeam
+		}
+
+		if err := tx.Create(&team).Error; err != nil {
+			return err
+		}
+		return tx.Model(&user).Update("team_id", team.ID).Error
+	})
+	if errors.Is(err, errAlreadyInTeam) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "You are already in a team",
+		})
+		return
+	}
+	// A team with the same name may have been created since the check above
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Team name already exists",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create team",
+		})
+		return
+	}
+
+	database.DB.Preload("Members").First(&team, team.ID)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Team created successfully",
+		"team":    teamResponse(&team),
+	})
+}
+
+// JoinTeam handles POST /teams/join
+func (tc *TeamController) JoinTeam(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	var req struct {
+		InviteCode string `json:"invite_code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var team models.Team
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the team row so concurrent joins cannot exceed the size limit
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("invite_code = ?", req.InviteCode).First(&team).Error; err != nil {
+			return err
+		}
+
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			return err
+		}
+		if user.TeamID != nil {
+			return errAlreadyInTeam
+		}
+
+		var memberCount int64
+		if err := tx.Model(&models.User{}).Where("team_id = ?", team.ID).Count(&memberCount).Error; err != nil {
+			return err
+		}
+		if int(memberCount) >= teamMaxSize() {
+			return errTeamFull
+		}
+
+		return tx.Model(&user).Update("team_id", team.ID).Error
+	})
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Invalid invite code",
+		})
+		return
+	case errors.Is(err, errAlreadyInTeam):
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "You are already in a team",
+		})
+		return
+	case errors.Is(err, errTeamFull):
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Team is full",
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to join team",
+		})
+		return
+	}
+
+	database.DB.Preload("Members").First(&team, team.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Joined team successfully",
+		"team":    teamResponse(&team),
+	})
+}
+
+// detachFromTeam removes a user locked in the transaction from their team and
+// hands captaincy to the longest-standing remaining member. An empty team is
+// disbanded when disbandEmpty is set.
+func detachFromTeam(tx *gorm.DB, user *models.User, disbandEmpty bool) error {
+	var team models.Team
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&team, *user.TeamID).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Model(user).Update("team_id", nil).Error; err != nil {
+		return err
+	}
+
+	if team.CaptainID != user.ID {
+		return nil
+	}
+
+	var successor models.User
+	err := tx.Where("team_id = ?", team.ID).Order("id ASC").First(&successor).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if disbandEmpty {
+			return tx.Delete(&team).Error
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Model(&team).Update("captain_id", successor.ID).Error
+}
+
+// LeaveTeam handles POST /teams/leave
+func (tc *TeamController) LeaveTeam(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			return err
+		}
+		if user.TeamID == nil {
+			return errNotInTeam
+		}
+
+		return detachFromTeam(tx, &user, true)
+	})
+
+	if errors.Is(err, errNotInTeam) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "You are not in a team",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to leave team",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Left team successfully",
+	})
+}
+
+// KickMember handles DELETE /teams/members/:user_id
+func (tc *TeamController) KickMember(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	memberID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user ID",
+		})
+		return
+	}
+
+	var team models.Team
+	if err := database.DB.Where("captain_id = ?", userID).First(&team).Error; err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Only the team captain can remove members",
+		})
+		return
+	}
+
+	if uint(memberID) == userID.(uint) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "The captain cannot be removed; leave the team instead",
+		})
+		return
+	}
+
+	err = withLockedUser(uint(memberID), func(tx *gorm.DB, member *models.User) error {
+		if member.TeamID == nil || *member.TeamID != team.ID {
+			return errNotInTeam
+		}
+
+		// Captaincy may have been handed over since the team was looked up
+		var locked models.Team
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, team.ID).Error; err != nil {
+			return err
+		}
+		if locked.CaptainID != userID.(uint) {
+			return errNotCaptain
+		}
+
+		return detachFromTeam(tx, member, false)
+	})
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, errNotInTeam):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Member not found in your team",
+		})
+		return
+	case errors.Is(err, errNotCaptain):
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Only the team captain can remove members",
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to remove member",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Member removed successfully",
+	})
+}
+
+// GetMyTeam handles GET /teams/me
+func (tc *TeamController) GetMyTeam(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	if user.TeamID == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "You are not in a team",
+		})
+		return
+	}
+
+	var team models.Team
+	if err := database.DB.Preload("Members").First(&team, *user.TeamID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Team not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"team": teamResponse(&team),
+	})
+}
+
+// RegenerateInviteCode handles POST /teams/invite-code
+func (tc *TeamController) RegenerateInviteCode(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	var team models.Team
+	if err := database.DB.Where("captain_id = ?", userID).First(&team).Error; err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Only the team captain can regenerate the invite code",
+		})
+		return
+	}
+
+	inviteCode, err := generateInviteCode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to regenerate invite code",
+		})
+		return
+	}
+
+	if err := database.DB.Model(&team).Update("invite_code", inviteCode).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to regenerate invite code",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Invite code regenerated successfully",
+		"invite_code": inviteCode,
+	})
+}
@@ -1,27 +1,57 @@
 package controllers
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/thelostleo/CTF-backend/database"
+	"github.com/thelostleo/CTF-backend/middleware"
 	"github.com/thelostleo/CTF-backend/models"
 	"github.com/thelostleo/CTF-backend/utils"
+	"gorm.io/gorm"
 )
 
 type UserController struct{}
 
-// hashPassword creates a SHA-256 hash of the password
-func (uc *UserController) hashPassword(password string) string {
-	hash := sha256.Sum256([]byte(password))
-	return hex.EncodeToString(hash[:])
+// hashPassword hashes the password with the configured password hasher
+func (uc *UserController) hashPassword(password string) (string, error) {
+	return utils.HashPassword(password)
 }
 
-// verifyPassword compares a plain password with a hashed password
-func (uc *UserController) verifyPassword(hashedPassword, password string) bool {
-	return uc.hashPassword(password) == hashedPassword
+// rehashPassword upgrades a user's stored hash in place after a successful login
+func (uc *UserController) rehashPassword(user *models.User, password string) {
+	hashedPassword, err := uc.hashPassword(password)
+	if err != nil {
+		log.Printf("Failed to rehash password for user %d: %v", user.ID, err)
+		return
+	}
+
+	if err := database.DB.Model(user).Update("password", hashedPassword).Error; err != nil {
+		log.Printf("Failed to store upgraded password hash for user %d: %v", user.ID, err)
+	}
+}
+
+// Deleted accounts are renamed to deletedUsernamePrefix<id> with an address at
+// deletedEmailDomain; both are reserved so nobody can take the name first and
+// make the deletion fail
+const (
+	deletedUsernamePrefix = "deleted-user-"
+	deletedEmailDomain    = "@deleted.invalid"
+)
+
+// isReservedUsername reports whether a username is reserved for deleted accounts
+func isReservedUsername(username string) bool {
+	return strings.HasPrefix(strings.ToLower(username), deletedUsernamePrefix)
+}
+
+// isReservedEmail reports whether an email address is reserved for deleted accounts
+func isReservedEmail(email string) bool {
+	return strings.HasSuffix(strings.ToLower(email), deletedEmailDomain)
 }
 
 // Register handles user registration
@@ -29,7 +59,7 @@ func (uc *UserController) Register(c *gin.Context) {
 	var request struct {
 		Username string `json:"username" binding:"required,min=3,max=50"`
 		Email    string `json:"email" binding:"required,email"`
-		Password string `json:"password" binding:"required,min=6"`
+		Password string `json:"password" binding:"required,min=6,max=72"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -40,6 +70,13 @@ func (uc *UserController) Register(c *gin.Context) {
 		return
 	}
 
+	if isReservedUsername(request.Username) || isReservedEmail(request.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "This username or email is reserved",
+		})
+		return
+	}
+
 	// Check if username already exists
 	var existingUser models.User
 	if err := database.DB.Where("username = ?", request.Username).First(&existingUser).Error; err == nil {
@@ -49,37 +86,63 @@ func (uc *UserController) Register(c *gin.Context) {
 		return
 	}
 
-	// Check if email already exists
-	if err := database.DB.Where("email = ?", request.Email).First(&existingUser).Error; err == nil {
+	// Check if email already exists; addresses are matched case-insensitively everywhere
+	if err := database.DB.Where("LOWER(email) = LOWER(?)", request.Email).First(&existingUser).Error; err == nil {
 		c.JSON(http.StatusConflict, gin.H{
 			"error": "Email already exists",
 		})
 		return
 	}
 
+	hashedPassword, err := uc.hashPassword(request.Password)
+	if errors.Is(err, utils.ErrPasswordTooLong) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Password is too long",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create user",
+		})
+		return
+	}
+
 	// Create new user
 	user := models.User{
 		Username: request.Username,
 		Email:    request.Email,
-		Password: uc.hashPassword(request.Password),
+		Password: hashedPassword,
 		Score:    0,
 		IsAdmin:  false, // Default to regular user
 	}
 
 	if err := database.DB.Create(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "Username or email already exists",
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to create user",
 		})
 		return
 	}
 
+	// A failed verification email does not fail the registration; it can be resent
+	if err := sendVerificationEmail(&user); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+	}
+
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "User registered successfully",
+		"message": "User registered successfully. Check your inbox to verify your email address.",
 		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"email":    user.Email,
-			"is_admin": user.IsAdmin,
+			"id":             user.ID,
+			"username":       user.Username,
+			"email":          user.Email,
+			"is_admin":       user.IsAdmin,
+			"email_verified": user.EmailVerified,
 		},
 	})
 }
@@ -99,25 +162,90 @@ func (uc *UserController) Login(c *gin.Context) {
 		return
 	}
 
-	// Find user by username
+	// Find user by username; unknown usernames are throttled like accounts and
+	// take as long as a wrong password, so neither reveals which accounts exist
 	var user models.User
 	if err := database.DB.Where("username = ?", request.Username).First(&user).Error; err != nil {
+		throttle, err := unknownUserThrottle(request.Username, time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to log in",
+			})
+			return
+		}
+		if throttle != nil {
+			respondThrottled(c, nil, request.Username, throttle)
+			return
+		}
+		checkDummyPassword(request.Password)
+		recordLoginAttempt(c, nil, request.Username, false, loginFailUnknownUser)
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"error": "Invalid credentials",
 		})
 		return
 	}
 
-	// Verify password
-	if !uc.verifyPassword(user.Password, request.Password) {
+	// Slow down and lock out repeated failures
+	attempt, err := checkPassword(&user, request.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to log in",
+		})
+		return
+	}
+	if attempt.throttle != nil {
+		respondLoginThrottled(c, &user, attempt.throttle)
+		return
+	}
+	if !attempt.ok {
+		recordLoginAttempt(c, &user, user.Username, false, loginFailBadPassword)
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"error": "Invalid credentials",
 		})
 		return
 	}
 
-	// Generate JWT token
-	token, err := utils.GenerateJWTToken(user.ID, user.Username, user.IsAdmin)
+	// Banned and suspended users cannot start new sessions
+	if user.IsBlocked(time.Now()) {
+		recordLoginAttempt(c, &user, user.Username, false, loginFailBlocked)
+		c.JSON(http.StatusForbidden, blockedAccountResponse(&user))
+		return
+	}
+
+	// Transparently upgrade legacy or outdated password hashes
+	if attempt.needsRehash {
+		uc.rehashPassword(&user, request.Password)
+	}
+
+	completeLogin(c, &user)
+}
+
+// completeLogin finishes an authenticated login: users with two-factor
+// authentication receive a pending token for /login/2fa, everyone else a
+// session. Failed attempts are only cleared once every factor succeeded.
+func completeLogin(c *gin.Context, user *models.User) {
+	if user.TOTPEnabled {
+		mfaToken, err := utils.GenerateMFAPendingToken(user.ID, user.Username, user.TokenVersion)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to generate token",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":      "Two-factor authentication required",
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+			"expires_in":   int(utils.GetMFAPendingTTL().Seconds()),
+		})
+		return
+	}
+
+	resetFailedLogins(c, user)
+
+	// Start a session with a short-lived access token and a rotating refresh token
+	tokens, err := issueSession(c, user, false)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to generate token",
@@ -125,17 +253,23 @@ func (uc *UserController) Login(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	c.JSON(http.StatusOK, tokens.apply(loginResponse(user)))
+}
+
+// loginResponse is the body returned once a login completes
+func loginResponse(user *models.User) gin.H {
+	return gin.H{
 		"message": "Login successful",
-		"token":   token,
 		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"email":    user.Email,
-			"is_admin": user.IsAdmin,
-			"score":    user.Score,
+			"id":             user.ID,
+			"username":       user.Username,
+			"email":          user.Email,
+			"is_admin":       user.IsAdmin,
+			"score":          user.Score,
+			"totp_enabled":   user.TOTPEnabled,
+			"email_verified": user.EmailVerified,
 		},
-	})
+	}
 }
 
 // GetProfile handles getting user profile
@@ -160,24 +294,444 @@ func (uc *UserController) GetProfile(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"email":    user.Email,
-			"is_admin": user.IsAdmin,
-			"score":    user.Score,
+			"id":             user.ID,
+			"username":       user.Username,
+			"email":          user.Email,
+			"is_admin":       user.IsAdmin,
+			"score":          user.Score,
+			"email_verified": user.EmailVerified,
+			"totp_enabled":   user.TOTPEnabled,
+		},
+	})
+}
+
+// UpdateProfile handles PUT /profile
+func (uc *UserController) UpdateProfile(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	var request struct {
+		Username string `json:"username" binding:"omitempty,min=3,max=50"`
+		Email    string `json:"email" binding:"omitempty,email"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	var existingUser models.User
+
+	if request.Username != "" && request.Username != user.Username {
+		if isReservedUsername(request.Username) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "This username is reserved",
+			})
+			return
+		}
+		// Check if username already exists
+		if err := database.DB.Where("username = ? AND id <> ?", request.Username, user.ID).First(&existingUser).Error; err == nil {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "Username already exists",
+			})
+			return
+		}
+		updates["username"] = request.Username
+	}
+
+	emailChanged := request.Email != "" && !strings.EqualFold(request.Email, user.Email)
+	if emailChanged {
+		if isReservedEmail(request.Email) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "This email is reserved",
+			})
+			return
+		}
+		// Check if email already exists
+		if err := database.DB.Where("LOWER(email) = LOWER(?) AND id <> ?", request.Email, user.ID).First(&existingUser).Error; err == nil {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "Email already exists",
+			})
+			return
+		}
+		// A new address has to be verified again
+		updates["email"] = request.Email
+		updates["email_verified"] = false
+	}
+
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "No changes provided",
+		})
+		return
+	}
+
+	if err := database.DB.Model(&user).Updates(updates).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "Username or email already exists",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update profile",
+		})
+		return
+	}
+	middleware.InvalidateUserCache(user.ID)
+
+	if emailChanged {
+		if err := sendVerificationEmail(&user); err != nil {
+			log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Profile updated successfully",
+		"user": gin.H{
+			"id":             user.ID,
+			"username":       user.Username,
+			"email":          user.Email,
+			"email_verified": user.EmailVerified,
 		},
 	})
 }
 
+// ChangePassword handles PUT /profile/password
+func (uc *UserController) ChangePassword(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	var request struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required,min=6,max=72"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	// Password guesses here count towards the same lockout as /login
+	attempt, err := checkPassword(&user, request.CurrentPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to change password",
+		})
+		return
+	}
+	if attempt.throttle != nil {
+		respondLoginThrottled(c, &user, attempt.throttle)
+		return
+	}
+	if !attempt.ok {
+		recordLoginAttempt(c, &user, user.Username, false, loginFailBadPassword)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Current password is incorrect",
+		})
+		return
+	}
+
+	hashedPassword, err := uc.hashPassword(request.NewPassword)
+	if errors.Is(err, utils.ErrPasswordTooLong) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Password is too long",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to change password",
+		})
+		return
+	}
+
+	// Keep the current session and log out every other device. Bumping the
+	// token version also ends outstanding access tokens, and API tokens are
+	// revoked, so a stolen credential does not outlive the old password.
+	sessionID := c.GetUint("sessionID")
+	var revoked int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"password":      hashedPassword,
+			"token_version": gorm.Expr("token_version + 1"),
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Select("token_version").First(&user, user.ID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.APIToken{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		// Outstanding reset links would otherwise still override the new password
+		if err := tx.Model(&models.UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", user.ID, models.TokenPasswordReset).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.Session{}).
+			Where("user_id = ? AND id <> ? AND revoked_at IS NULL", user.ID, sessionID).
+			Update("revoked_at", time.Now())
+		revoked = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to change password",
+		})
+		return
+	}
+	middleware.InvalidateUserCache(user.ID)
+
+	response := gin.H{
+		"message":          "Password changed successfully",
+		"revoked_sessions": revoked,
+	}
+
+	// The caller's access token carries the old token version; hand out a new
+	// one for the kept session (its refresh token keeps working)
+	if sessionID != 0 {
+		accessToken, err := utils.GenerateJWTToken(user.ID, user.Username, user.IsAdmin, sessionID, user.TokenVersion)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Password changed, but failed to issue a new access token",
+			})
+			return
+		}
+		response["token"] = accessToken
+		response["expires_in"] = int(utils.GetAccessTokenTTL().Seconds())
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteAccount handles DELETE /profile
+func (uc *UserController) DeleteAccount(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	var request struct {
+		Password string `json:"password" binding:"required"`
+		Code     string `json:"code"` // TOTP or recovery code when two-factor authentication is enabled
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	// Password guesses here count towards the same lockout as /login
+	attempt, err := checkPassword(&user, request.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to delete account",
+		})
+		return
+	}
+	if attempt.throttle != nil {
+		respondLoginThrottled(c, &user, attempt.throttle)
+		return
+	}
+	if !attempt.ok {
+		recordLoginAttempt(c, &user, user.Username, false, loginFailBadPassword)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Password is incorrect",
+		})
+		return
+	}
+
+	if user.IsAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Admins must be demoted before deleting their account",
+		})
+		return
+	}
+
+	// Scrambled credentials make the anonymised account unusable
+	randomPassword, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to delete account",
+		})
+		return
+	}
+	hashedPassword, err := uc.hashPassword(randomPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to delete account",
+		})
+		return
+	}
+
+	err = withLockedUser(user.ID, func(tx *gorm.DB, locked *models.User) error {
+		if locked.TOTPEnabled {
+			if request.Code == "" {
+				return errInvalidSecondFactor
+			}
+			if err := verifySecondFactor(tx, locked, request.Code); err != nil {
+				return err
+			}
+		}
+
+		// The anonymised row is kept (not soft-deleted) and its solves, awards
+		// and hint unlocks stay in the ledger, so the leaderboard, team scores and
+		// dynamic challenge values do not change; only personal data is removed
+		if locked.TeamID != nil {
+			if err := detachFromTeam(tx, locked, false); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(locked).Updates(map[string]interface{}{
+			"username":          fmt.Sprintf("%s%d", deletedUsernamePrefix, locked.ID),
+			"email":             fmt.Sprintf("%s%d%s", deletedUsernamePrefix, locked.ID, deletedEmailDomain),
+			"password":          hashedPassword,
+			"email_verified":    false,
+			"totp_enabled":      false,
+			"totp_secret":       "",
+			"totp_last_counter": 0,
+			"token_version":     gorm.Expr("token_version + 1"),
+		}).Error; err != nil {
+			return err
+		}
+
+		if _, err := revokeSessions(tx, locked.ID); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.APIToken{}).Where("user_id = ? AND revoked_at IS NULL", locked.ID).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		for _, model := range []interface{}{&models.RecoveryCode{}, &models.UserToken{}, &models.UserIdentity{}, &models.UserRole{}} {
+			if err := tx.Where("user_id = ?", locked.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		// Also redact the addresses of past logins and submissions
+		if err := tx.Model(&models.LoginAttempt{}).Where("user_id = ?", locked.ID).
+			Updates(map[string]interface{}{"username": "", "ip_address": "", "user_agent": ""}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Submission{}).Where("user_id = ?", locked.ID).
+			Update("ip_address", "").Error
+	})
+	if errors.Is(err, errInvalidSecondFactor) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "A valid two-factor code is required",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to delete account",
+		})
+		return
+	}
+	middleware.InvalidateUserCache(user.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Account deleted successfully",
+	})
+}
+
 // GetLeaderboard handles getting the leaderboard
 func (uc *UserController) GetLeaderboard(c *gin.Context) {
-	var users []models.User
+	event, err := models.LoadEvent(database.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch leaderboard",
+		})
+		return
+	}
+
+	// After the freeze the public sees standings as of the freeze time,
+	// while admins keep seeing live scores
+	isAdmin := c.GetBool("isAdmin")
+	frozen := event.IsFrozen(time.Now()) && !isAdmin
+
+	// Rank teams instead of users in team mode
+	if teamModeEnabled() {
+		uc.getTeamLeaderboard(c, event, frozen)
+		return
+	}
+
+	var users []struct {
+		ID       uint
+		Username string
+		Score    int
+	}
 
 	// Get top 10 users by score
-	if err := database.DB.Select("id, username, score").
-		Order("score DESC").
+	query := database.DB.Model(&models.User{}).Select("id, username, score")
+	if frozen {
+		ledger, args, err := frozenLedgerScore(database.DB, frozenUserLedgerScore, *event.FreezeTime)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch leaderboard",
+			})
+			return
+		}
+		query = database.DB.Model(&models.User{}).
+			Select("id, username, ("+ledger+") AS score", args...)
+	}
+	if err := query.Order("score DESC").
 		Limit(10).
-		Find(&users).Error; err != nil {
+		Scan(&users).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to fetch leaderboard",
 		})
@@ -196,41 +750,106 @@ func (uc *UserController) GetLeaderboard(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"leaderboard": leaderboard,
+		"frozen":      frozen,
+		"frozen_at":   frozenAt(event, frozen),
 	})
 }
 
-// RefreshToken handles JWT token refresh
-func (uc *UserController) RefreshToken(c *gin.Context) {
-	// Get the current token from Authorization header
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "Authorization header required",
+// getTeamLeaderboard responds with the top teams by score
+func (uc *UserController) getTeamLeaderboard(c *gin.Context, event *models.Event, frozen bool) {
+	var teams []struct {
+		ID    uint
+		Name  string
+		Score int
+	}
+
+	// Get top 10 teams by score
+	query := database.DB.Model(&models.Team{}).Select("id, name, score")
+	if frozen {
+		ledger, args, err := frozenLedgerScore(database.DB, frozenTeamLedgerScore, *event.FreezeTime)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch leaderboard",
+			})
+			return
+		}
+		query = database.DB.Model(&models.Team{}).
+			Select("id, name, ("+ledger+") AS score", args...)
+	}
+	if err := query.Order("score DESC").
+		Limit(10).
+		Scan(&teams).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch leaderboard",
 		})
 		return
 	}
 
-	// Extract token from "Bearer TOKEN" format
-	if len(authHeader) < 7 || authHeader[:7] != "Bearer " {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "Invalid authorization format",
+	leaderboard := make([]gin.H, len(teams))
+	for i, team := range teams {
+		leaderboard[i] = gin.H{
+			"rank":    i + 1,
+			"team_id": team.ID,
+			"team":    team.Name,
+			"score":   team.Score,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"mode":        "teams",
+		"leaderboard": leaderboard,
+		"frozen":      frozen,
+		"frozen_at":   frozenAt(event, frozen),
+	})
+}
+
+// frozenAt returns the freeze time when the leaderboard is frozen
+func frozenAt(event *models.Event, frozen bool) *time.Time {
+	if !frozen {
+		return nil
+	}
+	return event.FreezeTime
+}
+
+// RefreshToken handles POST /refresh-token by rotating the refresh token
+func (uc *UserController) RefreshToken(c *gin.Context) {
+	var request struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
 		})
 		return
 	}
 
-	oldToken := authHeader[7:]
-
-	// Generate a new token
-	newToken, err := utils.RefreshJWTToken(oldToken)
-	if err != nil {
+	tokens, err := rotateRefreshToken(c, request.RefreshToken)
+	switch {
+	case errors.Is(err, errRefreshTokenReuse):
 		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "Invalid token or token expired",
+			"error": "Refresh token reuse detected; the session has been revoked",
+		})
+		return
+	case errors.Is(err, errInvalidRefreshToken):
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Invalid or expired refresh token",
+		})
+		return
+	case errors.Is(err, errAccountBlocked):
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Account is banned or suspended",
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to refresh token",
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	c.JSON(http.StatusOK, tokens.apply(gin.H{
 		"message": "Token refreshed successfully",
-		"token":   newToken,
-	})
+	}))
 }
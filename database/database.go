@@ -36,6 +36,8 @@ func ConnectDatabase() {
 	// Configure GORM with appropriate settings for RDS
 	gormConfig := &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
+		// Map driver errors such as unique violations to gorm.ErrDuplicatedKey
+		TranslateError: true,
 	}
 
 	// Set connection pool settings for RDS
@@ -3,11 +3,14 @@ package main
 import (
 	"log"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/thelostleo/CTF-backend/api/routes"
+	"github.com/thelostleo/CTF-backend/controllers"
 	"github.com/thelostleo/CTF-backend/database"
 	"github.com/thelostleo/CTF-backend/models"
+	"github.com/thelostleo/CTF-backend/utils"
 )
 
 func main() {
@@ -17,16 +20,31 @@ func main() {
 		log.Println("Warning: .env file not found, using default values")
 	}
 
+	// Flags and TOTP secrets are sealed with FLAG_KEY or FLAG_KEY_FILE,
+	// generated only in development
+	if err := utils.InitFlagKey(); err != nil {
+		log.Fatal("Failed to load flag encryption key:", err)
+	}
+
 	// Connect to PostgreSQL database
 	database.ConnectDatabase()
 
 	// Auto-migrate database schemas
-	err = database.DB.AutoMigrate(&models.User{}, &models.Challenge{}, &models.Submission{})
+	err = models.MigrateAll(database.DB)
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 	log.Println("✅ Database migration completed successfully!")
 
+	// Migrations may drop duplicate solves, so cached scores are re-derived
+	usersUpdated, teamsUpdated, err := controllers.SyncScoresFromLedger(database.DB)
+	if err != nil {
+		log.Fatal("Failed to sync scores:", err)
+	}
+	if usersUpdated > 0 || teamsUpdated > 0 {
+		log.Printf("Synced cached scores of %d users and %d teams with the ledger", usersUpdated, teamsUpdated)
+	}
+
 	portString := os.Getenv("PORT")
 	if portString == "" {
 		portString = "6009"
@@ -34,6 +52,20 @@ func main() {
 
 	router := routes.NewRouter()
 
+	// Load JWT signing keys, refusing the default secret outside dev mode.
+	// Keys live in the database unless JWT_KEY_STORE=file, so every instance
+	// shares them and picks up rotations within a minute.
+	if os.Getenv("JWT_KEY_STORE") != "file" {
+		utils.SetKeyStore(models.NewDBKeyStore(database.DB))
+	}
+	if err := utils.InitKeyRing(); err != nil {
+		log.Fatal("Failed to initialize JWT signing keys:", err)
+	}
+	utils.StartKeyRotation(time.Minute)
+
+	// Announce release waves once their scheduled time has passed
+	controllers.StartReleaseScheduler(15 * time.Second)
+
 	// Gin has built-in server, so we can use Run() method
 	log.Printf("Starting CTF Backend server on port %s", portString)
 	log.Printf("Server running at http://localhost:%s", portString)
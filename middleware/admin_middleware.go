@@ -4,9 +4,12 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/thelostleo/CTF-backend/utils"
 )
 
-// AdminMiddleware checks if the authenticated user has admin privileges
+// AdminMiddleware checks if the authenticated user holds a staff role
+// (super-admin, challenge author, moderator or scorekeeper). Individual routes
+// are further restricted with RequirePermission.
 func AdminMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Check if user is authenticated (should be called after AuthMiddleware)
@@ -19,9 +22,8 @@ func AdminMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// Check if user is admin
-		isAdmin, exists := c.Get("isAdmin")
-		if !exists || !isAdmin.(bool) {
+		// Check if user is staff
+		if !c.GetBool("isStaff") {
 			c.JSON(http.StatusForbidden, gin.H{
 				"error": "Admin access required",
 			})
@@ -29,7 +31,51 @@ func AdminMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// User is authenticated and is admin, continue
+		// Staff accounts can rewrite flags or scores, so they may be required to
+		// use 2FA and to have passed it when this session or API token was created
+		if utils.IsAdminMFARequired() {
+			if !c.GetBool("mfaEnabled") {
+				c.JSON(http.StatusForbidden, gin.H{
+					"error": "Two-factor authentication must be enabled for admin accounts",
+				})
+				c.Abort()
+				return
+			}
+			if !c.GetBool("mfaVerified") {
+				c.JSON(http.StatusForbidden, gin.H{
+					"error": "Log in again with two-factor authentication to use admin routes",
+				})
+				c.Abort()
+				return
+			}
+		}
+
+		// User is authenticated and is staff, continue
 		c.Next()
 	}
 }
+
+// RequirePermission only lets users through whose roles grant the permission
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasPermission(c, permission) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":               "You do not have permission to perform this action",
+				"required_permission": permission,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// HasPermission reports whether the authenticated user holds the permission
+func HasPermission(c *gin.Context, permission string) bool {
+	value, exists := c.Get("permissions")
+	if !exists {
+		return false
+	}
+	permissions, ok := value.(map[string]bool)
+	return ok && permissions[permission]
+}
@@ -3,6 +3,7 @@ package middleware
 import (
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/thelostleo/CTF-backend/database"
@@ -13,56 +14,208 @@ import (
 // AuthMiddleware validates user authentication using JWT
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Get Authorization header
-		authHeader := c.GetHeader("Authorization")
-
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Authorization header required",
-			})
+		if status, body := authenticate(c); status != 0 {
+			c.JSON(status, body)
 			c.Abort()
 			return
 		}
 
-		// Extract token from "Bearer TOKEN" format
-		tokenParts := strings.Split(authHeader, " ")
-		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid authorization format. Use 'Bearer TOKEN'",
-			})
-			c.Abort()
-			return
+		// Continue to next handler
+		c.Next()
+	}
+}
+
+// OptionalAuthMiddleware sets user information when a valid token is present
+// but lets anonymous requests through
+func OptionalAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") != "" {
+			authenticate(c)
 		}
+		c.Next()
+	}
+}
 
-		token := tokenParts[1]
+// authenticate validates the bearer token and sets user information in the
+// context. It returns a non-zero status and error body when authentication fails.
+func authenticate(c *gin.Context) (int, gin.H) {
+	// Get Authorization header
+	authHeader := c.GetHeader("Authorization")
 
-		// Validate JWT token
-		claims, err := utils.ValidateJWTToken(token)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error":   "Invalid or expired token",
-				"details": err.Error(),
-			})
-			c.Abort()
-			return
+	if authHeader == "" {
+		return http.StatusUnauthorized, gin.H{
+			"error": "Authorization header required",
 		}
+	}
 
-		// Verify user still exists in database
-		var user models.User
-		if err := database.DB.First(&user, claims.UserID).Error; err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "User not found",
-			})
-			c.Abort()
-			return
+	// Extract token from "Bearer TOKEN" format
+	tokenParts := strings.Split(authHeader, " ")
+	if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
+		return http.StatusUnauthorized, gin.H{
+			"error": "Invalid authorization format. Use 'Bearer TOKEN'",
 		}
+	}
 
-		// Set user information in context for use in handlers
-		c.Set("userID", claims.UserID)
-		c.Set("username", claims.Username)
-		c.Set("isAdmin", claims.IsAdmin)
+	token := tokenParts[1]
 
-		// Continue to next handler
-		c.Next()
+	// Personal API tokens are opaque and looked up in the database
+	if strings.HasPrefix(token, models.APITokenPrefix) {
+		return authenticateAPIToken(c, token)
+	}
+
+	// Validate JWT token
+	claims, err := utils.ValidateJWTToken(token)
+	if err != nil {
+		return http.StatusUnauthorized, gin.H{
+			"error":   "Invalid or expired token",
+			"details": err.Error(),
+		}
+	}
+
+	// Load the current user state; authorization never trusts stale claims
+	user, err := loadUser(claims.UserID)
+	if err != nil {
+		return http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		}
+	}
+
+	// Tokens issued before the user's token version was bumped are revoked
+	if status, body := checkUserAccess(user, claims.Version); status != 0 {
+		return status, body
+	}
+
+	// Verify the session has not been logged out or revoked
+	var session models.Session
+	if err := database.DB.Where("id = ? AND user_id = ?", claims.SessionID, user.ID).
+		First(&session).Error; err != nil || !session.IsActive(time.Now()) {
+		return http.StatusUnauthorized, gin.H{
+			"error": "Session has been revoked or expired",
+		}
+	}
+
+	// Set user information in context for use in handlers
+	setUserContext(c, user)
+	c.Set("sessionID", claims.SessionID)
+	c.Set("mfaVerified", session.MFAVerified)
+
+	return 0, nil
+}
+
+// authenticateAPIToken validates a personal API token and checks that it
+// grants the scope the requested route needs
+func authenticateAPIToken(c *gin.Context, token string) (int, gin.H) {
+	now := time.Now()
+
+	var apiToken models.APIToken
+	if err := database.DB.Where("token_hash = ?", utils.HashToken(token)).First(&apiToken).Error; err != nil ||
+		!apiToken.IsActive(now) {
+		return http.StatusUnauthorized, gin.H{
+			"error": "Invalid, expired or revoked API token",
+		}
 	}
+
+	user, err := loadUser(apiToken.UserID)
+	if err != nil {
+		return http.StatusUnauthorized, gin.H{
+			"error": "User not found",
+		}
+	}
+
+	if status, body := checkUserAccess(user, apiToken.TokenVersion); status != 0 {
+		return status, body
+	}
+
+	scope := requiredScope(c)
+	if scope == "" || !apiToken.HasScope(scope) || (scope == models.ScopeAdmin && !user.IsStaff()) {
+		return http.StatusForbidden, gin.H{
+			"error":          "API token does not grant access to this endpoint",
+			"required_scope": scope,
+		}
+	}
+
+	// Record usage at most once a minute to avoid a write on every request
+	if apiToken.LastUsedAt == nil || now.Sub(*apiToken.LastUsedAt) > time.Minute {
+		database.DB.Model(&apiToken).Update("last_used_at", now)
+	}
+
+	setUserContext(c, user)
+	c.Set("apiTokenID", apiToken.ID)
+	c.Set("mfaVerified", apiToken.MFAVerified)
+
+	return 0, nil
+}
+
+// apiTokenRoutes lists the only routes API tokens can call, with the scope
+// each needs: challenges, flag submission and the scoreboard, plus their admin
+// counterparts for staff. Everything else, such as profile, session and token
+// management, needs a logged-in session.
+var apiTokenRoutes = map[string]string{
+	"GET /api/v1/event":                                 models.ScopeRead,
+	"GET /api/v1/challenges":                            models.ScopeRead,
+	"GET /api/v1/challenges/graph":                      models.ScopeRead,
+	"GET /api/v1/challenges/:id":                        models.ScopeRead,
+	"GET /api/v1/challenges/:id/hints":                  models.ScopeRead,
+	"GET /api/v1/files/:id":                             models.ScopeRead,
+	"GET /api/v1/leaderboard":                           models.ScopeRead,
+	"POST /api/v1/challenges/:id/submit":                models.ScopeSubmit,
+	"POST /api/v1/challenges/:id/hints/:hint_id/unlock": models.ScopeSubmit,
+
+	"GET /api/v1/admin/challenges/export":     models.ScopeAdmin,
+	"POST /api/v1/admin/challenges/import":    models.ScopeAdmin,
+	"POST /api/v1/admin/challenges":           models.ScopeAdmin,
+	"PUT /api/v1/admin/challenges/:id":        models.ScopeAdmin,
+	"GET /api/v1/admin/challenges/:id/files":  models.ScopeAdmin,
+	"POST /api/v1/admin/challenges/:id/files": models.ScopeAdmin,
+	"GET /api/v1/admin/challenges/:id/flags":  models.ScopeAdmin,
+	"POST /api/v1/admin/challenges/:id/flags": models.ScopeAdmin,
+	"GET /api/v1/admin/challenges/:id/hints":  models.ScopeAdmin,
+	"POST /api/v1/admin/challenges/:id/hints": models.ScopeAdmin,
+	"GET /api/v1/admin/scores/check":          models.ScopeAdmin,
+	"POST /api/v1/admin/scores/recompute":     models.ScopeAdmin,
+	"GET /api/v1/admin/awards":                models.ScopeAdmin,
+	"POST /api/v1/admin/awards":               models.ScopeAdmin,
+}
+
+// requiredScope returns the API token scope needed for the matched route, or
+// an empty string when the route is only available to logged-in sessions
+func requiredScope(c *gin.Context) string {
+	return apiTokenRoutes[c.Request.Method+" "+c.FullPath()]
+}
+
+// checkUserAccess rejects revoked tokens and banned or suspended users
+func checkUserAccess(user *models.User, tokenVersion uint) (int, gin.H) {
+	if tokenVersion != user.TokenVersion {
+		return http.StatusUnauthorized, gin.H{
+			"error": "Token has been revoked",
+		}
+	}
+
+	// Banned and suspended users are rejected on every request
+	if user.IsBanned {
+		return http.StatusForbidden, gin.H{
+			"error":  "Account is banned",
+			"reason": user.BanReason,
+		}
+	}
+	if user.IsSuspended(time.Now()) {
+		return http.StatusForbidden, gin.H{
+			"error":           "Account is suspended",
+			"reason":          user.BanReason,
+			"suspended_until": user.SuspendedUntil,
+		}
+	}
+	return 0, nil
+}
+
+// setUserContext sets the current user state in the context for handlers
+func setUserContext(c *gin.Context, user *models.User) {
+	c.Set("userID", user.ID)
+	c.Set("username", user.Username)
+	c.Set("isAdmin", user.IsAdmin)
+	c.Set("isStaff", user.IsStaff())
+	c.Set("roles", user.RoleNames())
+	c.Set("permissions", user.Permissions())
+	c.Set("mfaEnabled", user.TOTPEnabled)
+	c.Set("emailVerified", user.EmailVerified)
 }
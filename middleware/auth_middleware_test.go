@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thelostleo/CTF-backend/models"
+)
+
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		method string
+		route  string
+		scope  string
+	}{
+		{http.MethodGet, "/api/v1/challenges", models.ScopeRead},
+		{http.MethodGet, "/api/v1/leaderboard", models.ScopeRead},
+		{http.MethodPost, "/api/v1/challenges/:id/submit", models.ScopeSubmit},
+		{http.MethodPost, "/api/v1/admin/challenges", models.ScopeAdmin},
+		// Account management is never reachable with an API token
+		{http.MethodGet, "/api/v1/profile", ""},
+		{http.MethodGet, "/api/v1/profile/tokens", ""},
+		{http.MethodPost, "/api/v1/profile/tokens", ""},
+		{http.MethodGet, "/api/v1/sessions", ""},
+		{http.MethodDelete, "/api/v1/profile", ""},
+		{http.MethodPost, "/api/v1/admin/users/:id/ban", ""},
+		{http.MethodPost, "/api/v1/admin/keys/rotate", ""},
+	}
+
+	gin.SetMode(gin.TestMode)
+	for _, tt := range tests {
+		var scope string
+		router := gin.New()
+		router.Handle(tt.method, tt.route, func(c *gin.Context) { scope = requiredScope(c) })
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.route, nil))
+		if scope != tt.scope {
+			t.Errorf("%s %s: want scope %q, got %q", tt.method, tt.route, tt.scope, scope)
+		}
+	}
+}
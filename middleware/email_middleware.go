@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thelostleo/CTF-backend/utils"
+)
+
+// EmailVerifiedMiddleware blocks non-admins with an unverified email address
+// when REQUIRE_EMAIL_VERIFICATION is enabled
+func EmailVerifiedMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !utils.GetEnvAsBool("REQUIRE_EMAIL_VERIFICATION", false) {
+			c.Next()
+			return
+		}
+
+		if c.GetBool("isAdmin") || c.GetBool("emailVerified") {
+			c.Next()
+			return
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Please verify your email address first",
+		})
+		c.Abort()
+	}
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thelostleo/CTF-backend/database"
+	"github.com/thelostleo/CTF-backend/models"
+)
+
+// EventStartedMiddleware hides challenges from non-admins until the event starts
+func EventStartedMiddleware() gin.HandlerFunc {
+	return eventWindowMiddleware(false)
+}
+
+// EventRunningMiddleware only allows non-admins through while the event is running
+func EventRunningMiddleware() gin.HandlerFunc {
+	return eventWindowMiddleware(true)
+}
+
+// eventWindowMiddleware enforces the event start and, optionally, end time
+func eventWindowMiddleware(enforceEnd bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Admins can always access challenges, e.g. to test them before the start
+		if isAdmin, exists := c.Get("isAdmin"); exists && isAdmin.(bool) {
+			c.Next()
+			return
+		}
+
+		event, err := models.LoadEvent(database.DB)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to load event configuration",
+			})
+			c.Abort()
+			return
+		}
+
+		now := time.Now()
+		if !event.HasStarted(now) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":      "The CTF has not started yet",
+				"start_time": event.StartTime,
+			})
+			c.Abort()
+			return
+		}
+
+		if enforceEnd && event.HasEnded(now) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":    "The CTF has ended",
+				"end_time": event.EndTime,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+
+	"github.com/thelostleo/CTF-backend/database"
+	"github.com/thelostleo/CTF-backend/models"
+	"github.com/thelostleo/CTF-backend/utils"
+)
+
+// cachedUser is a user snapshot used for authorization decisions
+type cachedUser struct {
+	user     models.User
+	loadedAt time.Time
+}
+
+// userCache keeps recently loaded users for a short time so authorization
+// reflects current user state without a query on every request
+var userCache = struct {
+	sync.RWMutex
+	entries map[uint]cachedUser
+}{entries: make(map[uint]cachedUser)}
+
+// getUserCacheTTL returns how long users stay cached (USER_CACHE_TTL, default 10s)
+func getUserCacheTTL() time.Duration {
+	return utils.GetEnvAsDuration("USER_CACHE_TTL", 10*time.Second)
+}
+
+// loadUser returns the current state of a user, using the cache when fresh
+func loadUser(userID uint) (*models.User, error) {
+	ttl := getUserCacheTTL()
+
+	userCache.RLock()
+	entry, found := userCache.entries[userID]
+	userCache.RUnlock()
+	if found && time.Since(entry.loadedAt) < ttl {
+		user := entry.user
+		return &user, nil
+	}
+
+	var user models.User
+	if err := database.DB.Select("id, username, is_admin, email_verified, team_id, token_version, is_banned, ban_reason, suspended_until, totp_enabled").
+		Preload("Roles").
+		First(&user, userID).Error; err != nil {
+		InvalidateUserCache(userID)
+		return nil, err
+	}
+
+	if ttl > 0 {
+		userCache.Lock()
+		userCache.entries[userID] = cachedUser{user: user, loadedAt: time.Now()}
+		userCache.Unlock()
+	}
+	return &user, nil
+}
+
+// InvalidateUserCache drops a cached user so the next request sees its
+// current admin, role, ban and token version state
+func InvalidateUserCache(userID uint) {
+	userCache.Lock()
+	delete(userCache.entries, userID)
+	userCache.Unlock()
+}
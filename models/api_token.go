@@ -0,0 +1,63 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// API token scopes
+const (
+	ScopeRead   = "read"   // Read challenges, hints, files and the scoreboard
+	ScopeSubmit = "submit" // Submit flags and unlock hints
+	ScopeAdmin  = "admin"  // Admin challenge and scoring endpoints, only for staff users
+)
+
+// APITokenPrefix marks personal API tokens so they can be told apart from JWTs
+const APITokenPrefix = "ctf_"
+
+// ValidScopes lists the scopes an API token can be granted
+var ValidScopes = []string{ScopeRead, ScopeSubmit, ScopeAdmin}
+
+// APIToken is a named personal access token for bots and scripts, stored as a SHA-256 hash
+type APIToken struct {
+	ID           uint       `json:"id" gorm:"primarykey"`
+	UserID       uint       `json:"user_id" gorm:"not null;index"`
+	Name         string     `json:"name" gorm:"not null"`
+	Prefix       string     `json:"prefix"` // Leading characters, to recognise the token
+	TokenHash    string     `json:"-" gorm:"uniqueIndex;not null"`
+	Scopes       string     `json:"-" gorm:"not null"` // Comma separated
+	TokenVersion uint       `json:"-"`                 // User token version at creation
+	MFAVerified  bool       `json:"-"`                 // Created from a session that passed a second factor
+	ExpiresAt    *time.Time `json:"expires_at"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+	RevokedAt    *time.Time `json:"-"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// TableName overrides the table name used by APIToken to `api_tokens`
+func (APIToken) TableName() string {
+	return "api_tokens"
+}
+
+// ScopeList returns the granted scopes
+func (t *APIToken) ScopeList() []string {
+	if t.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(t.Scopes, ",")
+}
+
+// HasScope reports whether the token grants the scope
+func (t *APIToken) HasScope(scope string) bool {
+	for _, granted := range t.ScopeList() {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsActive reports whether the token is neither revoked nor expired
+func (t *APIToken) IsActive(now time.Time) bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || now.Before(*t.ExpiresAt))
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Award represents a manual score adjustment recorded in the solve ledger
+type Award struct {
+	ID        uint           `json:"id" gorm:"primarykey"`
+	UserID    *uint          `json:"user_id,omitempty" gorm:"index"`
+	TeamID    *uint          `json:"team_id,omitempty" gorm:"index"`
+	Value     int            `json:"value" gorm:"not null"` // May be negative for penalties
+	Reason    string         `json:"reason"`
+	AwardedBy uint           `json:"awarded_by"`
+	CreatedAt time.Time      `json:"created_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"` // Soft delete support
+}
+
+// TableName overrides the table name used by Award to `awards`
+func (Award) TableName() string {
+	return "awards"
+}
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"math"
+	"regexp"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -13,18 +16,133 @@ type Challenge struct {
 	Description string         `json:"description" gorm:"type:text"`
 	Category    string         `json:"category" gorm:"not null" binding:"required"`
 	Points      int            `json:"points" gorm:"not null" binding:"required"`
-	Flag        string         `json:"-" gorm:"not null"` // Hidden from JSON
-	Hint        string         `json:"hint"`
 	IsActive    bool           `json:"is_active" gorm:"default:true"`
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"` // Soft delete support
 
-	// File attachments (optional)
+	// Dynamic scoring (optional)
+	ScoringType   string `json:"scoring_type" gorm:"default:static"`
+	InitialPoints int    `json:"initial_points,omitempty"`
+	MinimumPoints int    `json:"minimum_points,omitempty"`
+	Decay         int    `json:"decay,omitempty"`          // Solves after which the minimum is reached
+	DecayFunction string `json:"decay_function,omitempty"` // linear or logarithmic
+
+	// Difficulty shown to players (optional): easy, medium, hard or insane
+	Difficulty string `json:"difficulty,omitempty" gorm:"index"`
+
+	// External file link (optional); uploaded files are listed in Files
 	FileURL string `json:"file_url,omitempty"`
 
+	// Stable identifier used by challenge bundles to match challenges across imports
+	Slug string `json:"slug,omitempty" gorm:"uniqueIndex:idx_challenges_slug,where:slug <> '' AND deleted_at IS NULL"`
+
+	// Staff member who created the challenge; authors may only edit their own
+	AuthorID *uint `json:"author_id,omitempty" gorm:"index"`
+
+	// Scheduled release (optional): hidden before ReleaseAt, after HideAt and
+	// until the release wave the challenge belongs to goes live
+	ReleaseAt *time.Time `json:"release_at,omitempty" gorm:"index"`
+	HideAt    *time.Time `json:"hide_at,omitempty" gorm:"index"`
+	WaveID    *uint      `json:"wave_id,omitempty" gorm:"index"`
+
+	// Whether players who have not met the prerequisites see the challenge as locked or not at all
+	LockedVisibility string `json:"locked_visibility,omitempty" gorm:"default:hidden"`
+	Locked           bool   `json:"locked" gorm:"-"` // Set per viewer
+	Solved           bool   `json:"solved" gorm:"-"` // Set per viewer
+
 	// Relationships
-	Submissions []Submission `json:"submissions,omitempty" gorm:"foreignKey:ChallengeID"`
+	Flags         []ChallengeFlag         `json:"-" gorm:"foreignKey:ChallengeID"` // Hidden from JSON
+	Hints         []Hint                  `json:"hints,omitempty" gorm:"foreignKey:ChallengeID"`
+	Submissions   []Submission            `json:"submissions,omitempty" gorm:"foreignKey:ChallengeID"`
+	Prerequisites []ChallengePrerequisite `json:"prerequisites,omitempty" gorm:"foreignKey:ChallengeID"`
+	Files         []ChallengeFile         `json:"files,omitempty" gorm:"foreignKey:ChallengeID"`
+	Tags          []Tag                   `json:"tags,omitempty" gorm:"many2many:challenge_tags"`
+}
+
+// Scoring types and decay functions supported by challenges
+const (
+	ScoringStatic  = "static"
+	ScoringDynamic = "dynamic"
+
+	DecayLinear      = "linear"
+	DecayLogarithmic = "logarithmic"
+)
+
+// Difficulty levels, from easiest to hardest
+const (
+	DifficultyEasy   = "easy"
+	DifficultyMedium = "medium"
+	DifficultyHard   = "hard"
+	DifficultyInsane = "insane"
+)
+
+// Difficulties lists the difficulty levels in ascending order
+var Difficulties = []string{DifficultyEasy, DifficultyMedium, DifficultyHard, DifficultyInsane}
+
+// ValidDifficulty reports whether a difficulty is known; empty means unrated
+func ValidDifficulty(difficulty string) bool {
+	if difficulty == "" {
+		return true
+	}
+	for _, known := range Difficulties {
+		if difficulty == known {
+			return true
+		}
+	}
+	return false
+}
+
+// slugDisallowedChars are collapsed into a dash by Slugify
+var slugDisallowedChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// SlugPattern matches valid challenge slugs
+var SlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,99}$`)
+
+// Slugify derives a slug such as "sql-injection-101" from a title
+func Slugify(title string) string {
+	slug := strings.Trim(slugDisallowedChars.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if len(slug) > 80 {
+		slug = strings.Trim(slug[:80], "-")
+	}
+	if slug == "" {
+		slug = "challenge"
+	}
+	return slug
+}
+
+// IsDynamic reports whether the challenge value decays with solves
+func (c *Challenge) IsDynamic() bool {
+	return c.ScoringType == ScoringDynamic
+}
+
+// ValueForSolves returns the points a dynamic challenge is worth after the given
+// number of solves. The first solve is worth the initial value and the value
+// reaches the minimum once Decay further solves have happened.
+func (c *Challenge) ValueForSolves(solves int) int {
+	if !c.IsDynamic() || c.Decay <= 0 {
+		return c.Points
+	}
+
+	n := float64(solves - 1)
+	if n <= 0 {
+		return c.InitialPoints
+	}
+
+	spread := float64(c.InitialPoints - c.MinimumPoints)
+	var value float64
+	switch c.DecayFunction {
+	case DecayLogarithmic:
+		value = float64(c.InitialPoints) - spread*math.Log1p(n)/math.Log1p(float64(c.Decay))
+	default:
+		value = float64(c.InitialPoints) - spread*n/float64(c.Decay)
+	}
+
+	points := int(math.Ceil(value))
+	if points < c.MinimumPoints {
+		return c.MinimumPoints
+	}
+	return points
 }
 
 // TableName overrides the table name used by Challenge to `challenges`
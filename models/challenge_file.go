@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// ChallengeFile is a file attached to a challenge and kept in file storage
+type ChallengeFile struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	ChallengeID uint      `json:"challenge_id" gorm:"not null;index"`
+	Name        string    `json:"name" gorm:"not null"`
+	StorageKey  string    `json:"-" gorm:"not null;uniqueIndex"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	SHA256      string    `json:"sha256" gorm:"column:sha256;not null"`
+	UploadedBy  *uint     `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// Signed, time-limited download URL for the viewer
+	DownloadURL string `json:"url,omitempty" gorm:"-"`
+}
+
+// TableName overrides the table name used by ChallengeFile to `challenge_files`
+func (ChallengeFile) TableName() string {
+	return "challenge_files"
+}
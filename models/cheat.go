@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// CheatIncident records a submission of a dynamic flag that belongs to someone else
+type CheatIncident struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	ChallengeID uint      `json:"challenge_id" gorm:"not null;index"`
+	UserID      uint      `json:"user_id" gorm:"not null;index"`
+	TeamID      *uint     `json:"team_id,omitempty"`
+	FlagOwner   string    `json:"flag_owner" gorm:"not null"` // user:<id> or team:<id> the flag was derived for
+	Flag        string    `json:"flag" gorm:"not null"`
+	IPAddress   string    `json:"ip_address,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// Relations
+	User      User      `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Challenge Challenge `json:"challenge,omitempty" gorm:"foreignKey:ChallengeID"`
+}
+
+// TableName overrides the table name used by CheatIncident to `cheat_incidents`
+func (CheatIncident) TableName() string {
+	return "cheat_incidents"
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Event holds the competition time window. Only a single row is used.
+type Event struct {
+	ID         uint       `json:"-" gorm:"primarykey"`
+	Name       string     `json:"name"`
+	StartTime  *time.Time `json:"start_time"`
+	EndTime    *time.Time `json:"end_time"`
+	FreezeTime *time.Time `json:"freeze_time"` // Scoreboard freeze (optional)
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// TableName overrides the table name used by Event to `events`
+func (Event) TableName() string {
+	return "events"
+}
+
+// Event states reported by Event.Status
+const (
+	EventNotStarted = "not_started"
+	EventRunning    = "running"
+	EventEnded      = "ended"
+)
+
+// LoadEvent returns the configured event, or an unbounded event if none is configured
+func LoadEvent(db *gorm.DB) (*Event, error) {
+	var event Event
+	err := db.Order("id ASC").First(&event).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &Event{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// HasStarted reports whether the event start time has passed
+func (e *Event) HasStarted(now time.Time) bool {
+	return e.StartTime == nil || !now.Before(*e.StartTime)
+}
+
+// HasEnded reports whether the event end time has passed
+func (e *Event) HasEnded(now time.Time) bool {
+	return e.EndTime != nil && !now.Before(*e.EndTime)
+}
+
+// IsFrozen reports whether the public scoreboard is frozen
+func (e *Event) IsFrozen(now time.Time) bool {
+	return e.FreezeTime != nil && !now.Before(*e.FreezeTime)
+}
+
+// Status returns whether the event has not started, is running or has ended
+func (e *Event) Status(now time.Time) string {
+	switch {
+	case !e.HasStarted(now):
+		return EventNotStarted
+	case e.HasEnded(now):
+		return EventEnded
+	default:
+		return EventRunning
+	}
+}
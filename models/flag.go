@@ -0,0 +1,138 @@
+package models
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/thelostleo/CTF-backend/utils"
+	"gorm.io/gorm"
+)
+
+// Flag match types supported by ChallengeFlag
+const (
+	FlagStatic          = "static"
+	FlagCaseInsensitive = "case_insensitive"
+	FlagRegex           = "regex"
+	FlagDynamic         = "dynamic" // Content is a secret; the flag is derived per user or team
+)
+
+// ErrUnknownFlagType is returned when a flag has an unsupported match type
+var ErrUnknownFlagType = errors.New("flag type must be static, case_insensitive, regex or dynamic")
+
+// ChallengeFlag represents one accepted flag for a challenge
+type ChallengeFlag struct {
+	ID          uint           `json:"id" gorm:"primarykey"`
+	ChallengeID uint           `json:"challenge_id" gorm:"not null;index"`
+	Content     string         `json:"-" gorm:"type:text;not null"` // Hidden from JSON
+	Type        string         `json:"type" gorm:"not null;default:static"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"` // Soft delete support
+}
+
+// TableName overrides the table name used by ChallengeFlag to `challenge_flags`
+func (ChallengeFlag) TableName() string {
+	return "challenge_flags"
+}
+
+// Validate checks that the flag type is known and regex flags compile
+func (f *ChallengeFlag) Validate() error {
+	switch f.Type {
+	case "":
+		f.Type = FlagStatic
+	case FlagStatic, FlagCaseInsensitive, FlagDynamic:
+	case FlagRegex:
+		if _, err := regexp.Compile(anchorPattern(f.Content)); err != nil {
+			return err
+		}
+	default:
+		return ErrUnknownFlagType
+	}
+	return nil
+}
+
+// IsDynamic reports whether the flag is derived per user or team
+func (f *ChallengeFlag) IsDynamic() bool {
+	return f.Type == FlagDynamic
+}
+
+// Matches reports whether the submitted flag is accepted by this flag for
+// the given owner (see FlagOwner); the owner only matters for dynamic flags
+func (f *ChallengeFlag) Matches(submitted, owner string) bool {
+	// Exact-match flags may be stored as a one-way salted hash
+	if utils.IsHashedFlag(f.Content) {
+		if f.Type == FlagCaseInsensitive {
+			submitted = strings.ToLower(submitted)
+		}
+		return utils.VerifyHashedFlag(f.Content, submitted)
+	}
+
+	content, err := f.Plaintext()
+	if err != nil {
+		return false
+	}
+
+	switch f.Type {
+	case FlagDynamic:
+		expected := utils.DeriveFlag(content, f.ChallengeID, owner)
+		return subtle.ConstantTimeCompare([]byte(expected), []byte(submitted)) == 1
+	case FlagCaseInsensitive:
+		return subtle.ConstantTimeCompare([]byte(strings.ToLower(content)), []byte(strings.ToLower(submitted))) == 1
+	case FlagRegex:
+		re, err := regexp.Compile(anchorPattern(content))
+		if err != nil {
+			return false
+		}
+		return re.MatchString(submitted)
+	default:
+		return subtle.ConstantTimeCompare([]byte(content), []byte(submitted)) == 1
+	}
+}
+
+// Plaintext returns the decrypted flag content; hashed flags cannot be reversed
+func (f *ChallengeFlag) Plaintext() (string, error) {
+	return utils.DecryptFlag(f.Content)
+}
+
+// BeforeSave seals the flag content so it is never stored in plaintext
+func (f *ChallengeFlag) BeforeSave(tx *gorm.DB) error {
+	if utils.IsSealedFlag(f.Content) {
+		return nil
+	}
+
+	var sealed string
+	var err error
+	switch {
+	case utils.GetFlagStorageMode() == "hash" && f.Type == FlagStatic:
+		sealed, err = utils.HashFlag(f.Content)
+	case utils.GetFlagStorageMode() == "hash" && f.Type == FlagCaseInsensitive:
+		sealed, err = utils.HashFlag(strings.ToLower(f.Content))
+	default:
+		// Regex patterns and dynamic secrets must stay reversible
+		sealed, err = utils.EncryptFlag(f.Content)
+	}
+	if err != nil {
+		return err
+	}
+
+	f.Content = sealed
+	return nil
+}
+
+// anchorPattern makes a regex flag match the whole submission
+func anchorPattern(pattern string) string {
+	return "^(?:" + pattern + ")$"
+}
+
+// FlagOwner identifies who a dynamic flag is derived for: the team in team
+// mode, otherwise the user
+func FlagOwner(userID uint, teamID *uint) string {
+	if teamID != nil {
+		return fmt.Sprintf("team:%d", *teamID)
+	}
+	return fmt.Sprintf("user:%d", userID)
+}
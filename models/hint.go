@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Hint represents a challenge hint that may cost points to unlock
+type Hint struct {
+	ID          uint           `json:"id" gorm:"primarykey"`
+	ChallengeID uint           `json:"challenge_id" gorm:"not null;index"`
+	Content     string         `json:"-" gorm:"type:text;not null"` // Hidden until unlocked
+	Cost        int            `json:"cost" gorm:"default:0"`
+	Position    int            `json:"position" gorm:"default:0"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"` // Soft delete support
+}
+
+// TableName overrides the table name used by Hint to `hints`
+func (Hint) TableName() string {
+	return "hints"
+}
+
+// HintUnlock records a user (and their team) purchasing a hint
+type HintUnlock struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	HintID    uint      `json:"hint_id" gorm:"not null;uniqueIndex:idx_hint_unlocks_user"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_hint_unlocks_user"`
+	TeamID    *uint     `json:"team_id,omitempty" gorm:"index"`
+	Cost      int       `json:"cost" gorm:"not null"` // Cost at the time of purchase
+	CreatedAt time.Time `json:"created_at"`
+
+	// Relations
+	Hint Hint `json:"-" gorm:"foreignKey:HintID"`
+}
+
+// TableName overrides the table name used by HintUnlock to `hint_unlocks`
+func (HintUnlock) TableName() string {
+	return "hint_unlocks"
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// LoginAttempt records a password or two-factor login attempt
+type LoginAttempt struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	UserID    *uint     `json:"user_id,omitempty" gorm:"index"` // Nil when the username is unknown
+	Username  string    `json:"username" gorm:"index"`
+	IPAddress string    `json:"ip_address" gorm:"index"`
+	UserAgent string    `json:"user_agent"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason,omitempty"` // Why a failed attempt was refused
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// TableName overrides the table name used by LoginAttempt to `login_attempts`
+func (LoginAttempt) TableName() string {
+	return "login_attempts"
+}
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"fmt"
+
+	"github.com/thelostleo/CTF-backend/utils"
 	"gorm.io/gorm"
 )
 
@@ -10,10 +13,191 @@ func GetAllModels() []interface{} {
 		&User{},
 		&Challenge{},
 		&Submission{},
+		&Team{},
+		&Award{},
+		&Event{},
+		&Hint{},
+		&HintUnlock{},
+		&ChallengeFlag{},
+		&CheatIncident{},
+		&Session{},
+		&RefreshToken{},
+		&RecoveryCode{},
+		&UserToken{},
+		&OAuthState{},
+		&UserIdentity{},
+		&APIToken{},
+		&UserRole{},
+		&LoginAttempt{},
+		&ChallengePrerequisite{},
+		&ReleaseWave{},
+		&Announcement{},
+		&ChallengeFile{},
+		&Tag{},
+		&SigningKey{},
 	}
 }
 
 // MigrateAll runs auto-migration for all models
 func MigrateAll(db *gorm.DB) error {
-	return db.AutoMigrate(GetAllModels()...)
+	// Must run first: the unique solve index cannot be created over duplicates
+	if err := migrateDuplicateSolves(db); err != nil {
+		return err
+	}
+	if err := db.AutoMigrate(GetAllModels()...); err != nil {
+		return err
+	}
+	if err := migrateLegacyHints(db); err != nil {
+		return err
+	}
+	if err := migrateLegacyFlags(db); err != nil {
+		return err
+	}
+	if err := migratePlaintextFlags(db); err != nil {
+		return err
+	}
+	if err := migrateChallengeSlugs(db); err != nil {
+		return err
+	}
+	return migrateTOTPSecrets(db)
+}
+
+// migrateDuplicateSolves keys correct submissions by the user or team they
+// scored for and soft-deletes all but the earliest solve of a challenge per
+// key. Racing submissions left such duplicates before the unique solve index
+// existed; cached scores are recomputed from the ledger at startup.
+func migrateDuplicateSolves(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&Submission{}) {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if !tx.Migrator().HasColumn(&Submission{}, "SolvedBy") {
+			if err := tx.Migrator().AddColumn(&Submission{}, "SolvedBy"); err != nil {
+				return err
+			}
+		}
+		if tx.Migrator().HasIndex(&Submission{}, "idx_submissions_user_solve") {
+			if err := tx.Migrator().DropIndex(&Submission{}, "idx_submissions_user_solve"); err != nil {
+				return err
+			}
+		}
+
+		// Same owners as FlagOwner: the team in team mode, the user otherwise
+		owner := "'user:' || user_id"
+		if utils.GetEnvAsBool("TEAM_MODE", false) && tx.Migrator().HasColumn(&Submission{}, "TeamID") {
+			owner = "CASE WHEN team_id IS NOT NULL THEN 'team:' || team_id ELSE 'user:' || user_id END"
+		}
+		if err := tx.Exec(`UPDATE submissions SET solved_by = ` + owner + `
+			WHERE is_correct AND (solved_by IS NULL OR solved_by = '')`).Error; err != nil {
+			return err
+		}
+
+		return tx.Exec(`UPDATE submissions SET deleted_at = NOW() WHERE id IN (
+			SELECT id FROM (
+				SELECT id, ROW_NUMBER() OVER (PARTITION BY solved_by, challenge_id ORDER BY submitted_at, id) AS n
+				FROM submissions WHERE is_correct AND deleted_at IS NULL
+			) solves WHERE n > 1)`).Error
+	})
+}
+
+// migrateLegacyHints moves the old single challenges.hint column into free hints
+func migrateLegacyHints(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&Challenge{}, "hint") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`INSERT INTO hints (challenge_id, content, cost, position, created_at, updated_at)
+			SELECT id, hint, 0, 0, NOW(), NOW() FROM challenges
+			WHERE hint IS NOT NULL AND hint <> ''`).Error; err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&Challenge{}, "hint")
+	})
+}
+
+// migrateLegacyFlags moves the old single challenges.flag column into static flags
+func migrateLegacyFlags(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&Challenge{}, "flag") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`INSERT INTO challenge_flags (challenge_id, content, type, created_at, updated_at)
+			SELECT id, flag, 'static', NOW(), NOW() FROM challenges
+			WHERE flag IS NOT NULL AND flag <> ''`).Error; err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&Challenge{}, "flag")
+	})
+}
+
+// migratePlaintextFlags seals flags that were stored before hashing or
+// encryption at rest and redacts flags kept on correct submissions
+func migratePlaintextFlags(db *gorm.DB) error {
+	var flags []ChallengeFlag
+	if err := db.Where("content NOT LIKE ? AND content NOT LIKE ?", "$sha256$%", "$enc$%").
+		Find(&flags).Error; err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for i := range flags {
+			// BeforeSave seals the content
+			if err := tx.Save(&flags[i]).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&Submission{}).
+			Where("is_correct = ? AND flag <> ?", true, RedactedFlag).
+			Update("flag", RedactedFlag).Error
+	})
+}
+
+// migrateChallengeSlugs gives challenges created before slugs existed a
+// unique slug derived from their title and ID
+func migrateChallengeSlugs(db *gorm.DB) error {
+	var challenges []Challenge
+	if err := db.Unscoped().Select("id, title").Where("slug IS NULL OR slug = ''").Find(&challenges).Error; err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, challenge := range challenges {
+			slug := fmt.Sprintf("%s-%d", Slugify(challenge.Title), challenge.ID)
+			if err := tx.Unscoped().Model(&Challenge{}).Where("id = ?", challenge.ID).
+				Update("slug", slug).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// migrateTOTPSecrets reseals TOTP secrets that were encrypted with the flag key
+// under the key derived for TOTP secrets
+func migrateTOTPSecrets(db *gorm.DB) error {
+	var users []User
+	if err := db.Unscoped().Select("id, totp_secret").Where("totp_secret LIKE ?", "$enc$%").Find(&users).Error; err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, user := range users {
+			secret, err := utils.DecryptTOTPSecret(user.TOTPSecret)
+			if err != nil {
+				return err
+			}
+			sealed, err := utils.EncryptTOTPSecret(secret)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&User{}).Where("id = ? AND totp_secret = ?", user.ID, user.TOTPSecret).
+				Update("totp_secret", sealed).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
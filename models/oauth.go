@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+)
+
+// OAuthState is a pending OpenID Connect login; it is consumed by the callback
+type OAuthState struct {
+	ID           uint      `json:"id" gorm:"primarykey"`
+	StateHash    string    `json:"-" gorm:"uniqueIndex;not null"`
+	Provider     string    `json:"provider" gorm:"not null"`
+	CodeVerifier string    `json:"-" gorm:"not null"` // PKCE verifier
+	Nonce        string    `json:"-" gorm:"not null"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// TableName overrides the table name used by OAuthState to `oauth_states`
+func (OAuthState) TableName() string {
+	return "oauth_states"
+}
+
+// UserIdentity links a user to an account at an external identity provider
+type UserIdentity struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	Provider  string    `json:"provider" gorm:"not null;uniqueIndex:idx_user_identities_subject"`
+	Subject   string    `json:"-" gorm:"not null;uniqueIndex:idx_user_identities_subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Relations
+	User User `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// TableName overrides the table name used by UserIdentity to `user_identities`
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
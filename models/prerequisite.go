@@ -0,0 +1,58 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// Prerequisite types supported by ChallengePrerequisite
+const (
+	PrerequisiteChallenge      = "challenge"       // Solve another challenge
+	PrerequisiteCategoryPoints = "category_points" // Score enough points in a category
+)
+
+// How challenges with unmet prerequisites are shown to players
+const (
+	LockedHidden = "hidden" // Left out of challenge lists
+	LockedShown  = "locked" // Listed without their content
+)
+
+// ChallengePrerequisite is a condition a player (or their team) must meet
+// before a challenge unlocks; every prerequisite of a challenge must be met
+type ChallengePrerequisite struct {
+	ID                  uint      `json:"id" gorm:"primarykey"`
+	ChallengeID         uint      `json:"challenge_id" gorm:"not null;index"`
+	Type                string    `json:"type" gorm:"not null"`
+	RequiredChallengeID *uint     `json:"required_challenge_id,omitempty" gorm:"index"`
+	Category            string    `json:"category,omitempty"`
+	MinPoints           int       `json:"min_points,omitempty"`
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+// TableName overrides the table name used by ChallengePrerequisite to `challenge_prerequisites`
+func (ChallengePrerequisite) TableName() string {
+	return "challenge_prerequisites"
+}
+
+// Validate checks that the fields required by the prerequisite type are set
+func (p *ChallengePrerequisite) Validate() error {
+	switch p.Type {
+	case PrerequisiteChallenge:
+		if p.RequiredChallengeID == nil || *p.RequiredChallengeID == 0 {
+			return errors.New("challenge prerequisites need a challenge_id")
+		}
+		if *p.RequiredChallengeID == p.ChallengeID {
+			return errors.New("a challenge cannot require itself")
+		}
+		p.Category = ""
+		p.MinPoints = 0
+	case PrerequisiteCategoryPoints:
+		if p.Category == "" || p.MinPoints <= 0 {
+			return errors.New("category_points prerequisites need a category and positive min_points")
+		}
+		p.RequiredChallengeID = nil
+	default:
+		return errors.New("prerequisite type must be challenge or category_points")
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ReleaseWave is a named group of challenges that go live together, either
+// at a scheduled time or when an admin triggers it
+type ReleaseWave struct {
+	ID         uint       `json:"id" gorm:"primarykey"`
+	Name       string     `json:"name" gorm:"uniqueIndex;not null"`
+	ReleaseAt  *time.Time `json:"release_at"`  // Scheduled release, nil until scheduled
+	ReleasedAt *time.Time `json:"released_at"` // When the release was announced
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// TableName overrides the table name used by ReleaseWave to `release_waves`
+func (ReleaseWave) TableName() string {
+	return "release_waves"
+}
+
+// IsLive reports whether the wave's challenges are visible to players
+func (w *ReleaseWave) IsLive(now time.Time) bool {
+	return w.ReleasedAt != nil || (w.ReleaseAt != nil && !now.Before(*w.ReleaseAt))
+}
+
+// Announcement is a message shown to all players, e.g. when a wave goes live
+type Announcement struct {
+	ID        uint           `json:"id" gorm:"primarykey"`
+	Title     string         `json:"title" gorm:"not null"`
+	Content   string         `json:"content" gorm:"type:text"`
+	WaveID    *uint          `json:"wave_id,omitempty" gorm:"index"`
+	CreatedAt time.Time      `json:"created_at" gorm:"index"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"` // Soft delete support
+}
+
+// TableName overrides the table name used by Announcement to `announcements`
+func (Announcement) TableName() string {
+	return "announcements"
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"time"
+)
+
+// Staff roles. Users with IsAdmin are super-admins and hold every permission.
+const (
+	RoleSuperAdmin      = "super_admin"
+	RoleChallengeAuthor = "challenge_author"
+	RoleModerator       = "moderator"
+	RoleScorekeeper     = "scorekeeper"
+)
+
+// Permissions checked by the admin API
+const (
+	PermDashboardView      = "dashboard.view"
+	PermChallengesWrite    = "challenges.write"     // Create challenges and edit own ones
+	PermChallengesWriteAll = "challenges.write_all" // Edit any challenge
+	PermUsersView          = "users.view"
+	PermUsersManage        = "users.manage" // Ban, suspend and revoke tokens
+	PermCheatView          = "cheat.view"
+	PermScoresManage       = "scores.manage"
+	PermEventManage        = "event.manage"
+	PermRolesManage        = "roles.manage"
+	PermSystemManage       = "system.manage"
+)
+
+// RolePermissions lists the permissions granted by each role
+var RolePermissions = map[string][]string{
+	RoleChallengeAuthor: {PermDashboardView, PermChallengesWrite},
+	RoleModerator:       {PermDashboardView, PermUsersView, PermUsersManage, PermCheatView},
+	RoleScorekeeper:     {PermDashboardView, PermUsersView, PermScoresManage},
+	RoleSuperAdmin: {
+		PermDashboardView, PermChallengesWrite, PermChallengesWriteAll, PermUsersView, PermUsersManage,
+		PermCheatView, PermScoresManage, PermEventManage, PermRolesManage, PermSystemManage,
+	},
+}
+
+// IsValidRole reports whether the role exists
+func IsValidRole(role string) bool {
+	_, ok := RolePermissions[role]
+	return ok
+}
+
+// UserRole grants a staff role to a user
+type UserRole struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_user_roles_user_role"`
+	Role      string    `json:"role" gorm:"not null;uniqueIndex:idx_user_roles_user_role"`
+	GrantedBy uint      `json:"granted_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName overrides the table name used by UserRole to `user_roles`
+func (UserRole) TableName() string {
+	return "user_roles"
+}
+
+// RoleNames returns the user's roles, with super_admin for admins
+func (u *User) RoleNames() []string {
+	roles := []string{}
+	if u.IsAdmin {
+		roles = append(roles, RoleSuperAdmin)
+	}
+	for _, role := range u.Roles {
+		if role.Role != RoleSuperAdmin {
+			roles = append(roles, role.Role)
+		}
+	}
+	return roles
+}
+
+// Permissions returns the set of permissions granted by the user's roles
+func (u *User) Permissions() map[string]bool {
+	permissions := make(map[string]bool)
+	for _, role := range u.RoleNames() {
+		for _, permission := range RolePermissions[role] {
+			permissions[permission] = true
+		}
+	}
+	return permissions
+}
+
+// IsStaff reports whether the user holds any staff role
+func (u *User) IsStaff() bool {
+	return len(u.RoleNames()) > 0
+}
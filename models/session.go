@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+)
+
+// Session represents a logged-in device. Its refresh tokens rotate on every
+// use and all belong to the same token family.
+type Session struct {
+	ID          uint       `json:"id" gorm:"primarykey"`
+	UserID      uint       `json:"user_id" gorm:"not null;index"`
+	UserAgent   string     `json:"user_agent"`
+	IPAddress   string     `json:"ip_address"`
+	MFAVerified bool       `json:"mfa_verified"` // The login passed a second factor
+	ExpiresAt   time.Time  `json:"expires_at"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt  time.Time  `json:"last_used_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// TableName overrides the table name used by Session to `sessions`
+func (Session) TableName() string {
+	return "sessions"
+}
+
+// IsActive reports whether the session is neither revoked nor expired
+func (s *Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// RefreshToken is an opaque, single-use token stored as a SHA-256 hash
+type RefreshToken struct {
+	ID        uint       `json:"id" gorm:"primarykey"`
+	SessionID uint       `json:"session_id" gorm:"not null;index"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"` // Set once the token has been rotated
+	CreatedAt time.Time  `json:"created_at"`
+
+	// Relations
+	Session Session `json:"-" gorm:"foreignKey:SessionID"`
+}
+
+// TableName overrides the table name used by RefreshToken to `refresh_tokens`
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"time"
+
+	"github.com/thelostleo/CTF-backend/utils"
+	"gorm.io/gorm"
+)
+
+// SigningKey stores a JWT signing key shared by every instance. The private
+// key is sealed with a key derived from the flag key.
+type SigningKey struct {
+	KID         string     `json:"kid" gorm:"primaryKey"`
+	Algorithm   string     `json:"alg" gorm:"not null"`
+	PrivateKey  string     `json:"-" gorm:"type:text;not null"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ActivatesAt time.Time  `json:"activates_at"`
+	RetiredAt   *time.Time `json:"retired_at,omitempty"`
+}
+
+// TableName overrides the table name used by SigningKey to `signing_keys`
+func (SigningKey) TableName() string {
+	return "signing_keys"
+}
+
+// signingKeyLock is the advisory lock taken while the key ring is rotated
+const signingKeyLock = 7216530111
+
+// DBKeyStore keeps the JWT key ring in the database so every instance signs
+// and verifies with the same keys and only one of them rotates
+type DBKeyStore struct {
+	DB *gorm.DB
+}
+
+// NewDBKeyStore creates a key store backed by the signing_keys table
+func NewDBKeyStore(db *gorm.DB) *DBKeyStore {
+	return &DBKeyStore{DB: db}
+}
+
+// Load reads and decrypts every stored key
+func (s *DBKeyStore) Load() ([]*utils.SigningKey, error) {
+	return loadSigningKeys(s.DB)
+}
+
+// Update changes the stored keys under a transaction-scoped advisory lock
+func (s *DBKeyStore) Update(fn func(keys []*utils.SigningKey) ([]*utils.SigningKey, error)) ([]*utils.SigningKey, error) {
+	var result []*utils.SigningKey
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", signingKeyLock).Error; err != nil {
+			return err
+		}
+
+		keys, err := loadSigningKeys(tx)
+		if err != nil {
+			return err
+		}
+		previous := make(map[string]bool, len(keys))
+		for _, key := range keys {
+			previous[key.KID] = true
+		}
+
+		updated, err := fn(keys)
+		if err != nil {
+			return err
+		}
+		if updated == nil {
+			result = keys
+			return nil
+		}
+
+		kept := make([]string, 0, len(updated))
+		for _, key := range updated {
+			kept = append(kept, key.KID)
+			if previous[key.KID] {
+				if err := tx.Model(&SigningKey{}).Where("kid = ?", key.KID).Updates(map[string]interface{}{
+					"activates_at": key.ActivatesAt,
+					"retired_at":   key.RetiredAt,
+				}).Error; err != nil {
+					return err
+				}
+				continue
+			}
+
+			sealed, err := key.SealPrivateKey()
+			if err != nil {
+				return err
+			}
+			if err := tx.Create(&SigningKey{
+				KID:         key.KID,
+				Algorithm:   key.Algorithm,
+				PrivateKey:  sealed,
+				CreatedAt:   key.CreatedAt,
+				ActivatesAt: key.ActivatesAt,
+				RetiredAt:   key.RetiredAt,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("kid NOT IN ?", kept).Delete(&SigningKey{}).Error; err != nil {
+			return err
+		}
+		result = updated
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// loadSigningKeys reads and decrypts the stored keys in activation order
+func loadSigningKeys(db *gorm.DB) ([]*utils.SigningKey, error) {
+	var records []SigningKey
+	if err := db.Order("activates_at ASC, created_at ASC").Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	keys := make([]*utils.SigningKey, 0, len(records))
+	for _, record := range records {
+		key := &utils.SigningKey{
+			KID:         record.KID,
+			Algorithm:   record.Algorithm,
+			CreatedAt:   record.CreatedAt,
+			ActivatesAt: record.ActivatesAt,
+			RetiredAt:   record.RetiredAt,
+		}
+		if err := key.OpenPrivateKey(record.PrivateKey); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
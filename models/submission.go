@@ -9,8 +9,10 @@ import (
 // Submission represents a flag submission
 type Submission struct {
 	ID          uint           `json:"id" gorm:"primarykey"`
-	UserID      uint           `json:"user_id" gorm:"not null"`
-	ChallengeID uint           `json:"challenge_id" gorm:"not null"`
+	UserID      uint           `json:"user_id" gorm:"not null;index"`
+	ChallengeID uint           `json:"challenge_id" gorm:"not null;uniqueIndex:idx_submissions_solve,priority:2"`
+	TeamID      *uint          `json:"team_id,omitempty" gorm:"index"`
+	SolvedBy    string         `json:"-" gorm:"uniqueIndex:idx_submissions_solve,priority:1,where:is_correct AND deleted_at IS NULL"` // FlagOwner the solve scored for, set on correct submissions
 	Flag        string         `json:"flag" gorm:"not null"`
 	IsCorrect   bool           `json:"is_correct" gorm:"default:false"`
 	IPAddress   string         `json:"ip_address,omitempty"`
@@ -22,6 +24,9 @@ type Submission struct {
 	Challenge Challenge `json:"challenge,omitempty" gorm:"foreignKey:ChallengeID"`
 }
 
+// RedactedFlag replaces the flag of correct submissions so solves do not leak answers
+const RedactedFlag = "[redacted]"
+
 // TableName overrides the table name used by Submission to `submissions`
 func (Submission) TableName() string {
 	return "submissions"
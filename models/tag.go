@@ -0,0 +1,23 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Tag labels challenges across categories, e.g. "crypto", "beginner" or "osint"
+type Tag struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	Name      string    `json:"name" gorm:"uniqueIndex;not null"`
+	CreatedAt time.Time `json:"-"`
+}
+
+// TableName overrides the table name used by Tag to `tags`
+func (Tag) TableName() string {
+	return "tags"
+}
+
+// NormalizeTagName lowercases a tag and trims surrounding whitespace
+func NormalizeTagName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Team represents a group of users competing together
+type Team struct {
+	ID         uint           `json:"id" gorm:"primarykey"`
+	Name       string         `json:"name" gorm:"unique;not null" binding:"required"`
+	InviteCode string         `json:"-" gorm:"uniqueIndex;not null"` // Only shown to members
+	CaptainID  uint           `json:"captain_id" gorm:"not null"`
+	Score      int            `json:"score" gorm:"default:0"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index"` // Soft delete support
+
+	// Relationships
+	Members []User `json:"members,omitempty" gorm:"foreignKey:TeamID"`
+}
+
+// TableName overrides the table name used by Team to `teams`
+func (Team) TableName() string {
+	return "teams"
+}
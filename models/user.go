@@ -14,15 +14,49 @@ type User struct {
 	Password  string         `json:"-" gorm:"not null"` // Hidden from JSON
 	Score     int            `json:"score" gorm:"default:0"`
 	IsAdmin   bool           `json:"is_admin" gorm:"default:false"`
+	TeamID    *uint          `json:"team_id,omitempty" gorm:"index"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"` // Soft delete support
 
+	// Access control; incrementing TokenVersion invalidates every outstanding token
+	EmailVerified  bool       `json:"email_verified" gorm:"default:false"`
+	TokenVersion   uint       `json:"-" gorm:"not null;default:0"`
+	IsBanned       bool       `json:"is_banned" gorm:"default:false"`
+	BanReason      string     `json:"ban_reason,omitempty"`
+	SuspendedUntil *time.Time `json:"suspended_until,omitempty"`
+
+	// Login lockout after repeated failed attempts
+	FailedLogins      int        `json:"failed_logins" gorm:"default:0"`
+	LastFailedLoginAt *time.Time `json:"-"`
+	LockedUntil       *time.Time `json:"locked_until,omitempty"`
+
+	// Two-factor authentication; the TOTP secret is encrypted at rest
+	TOTPSecret      string `json:"-"`
+	TOTPEnabled     bool   `json:"totp_enabled" gorm:"default:false"`
+	TOTPLastCounter int64  `json:"-" gorm:"default:0"` // Last accepted time step, prevents code replay
+
 	// Relationships
 	Submissions []Submission `json:"submissions,omitempty" gorm:"foreignKey:UserID"`
+	Roles       []UserRole   `json:"roles,omitempty" gorm:"foreignKey:UserID"`
 }
 
 // TableName overrides the table name used by User to `users`
 func (User) TableName() string {
 	return "users"
 }
+
+// IsSuspended reports whether the user is temporarily suspended at the given time
+func (u *User) IsSuspended(now time.Time) bool {
+	return u.SuspendedUntil != nil && now.Before(*u.SuspendedUntil)
+}
+
+// IsLocked reports whether the account is temporarily locked after failed logins
+func (u *User) IsLocked(now time.Time) bool {
+	return u.LockedUntil != nil && now.Before(*u.LockedUntil)
+}
+
+// IsBlocked reports whether the user is banned or suspended at the given time
+func (u *User) IsBlocked(now time.Time) bool {
+	return u.IsBanned || u.IsSuspended(now)
+}
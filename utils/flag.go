@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// flagFormatPlaceholder marks where the flag body goes in FLAG_FORMAT
+const flagFormatPlaceholder = "..."
+
+// GetFlagFormat returns the configured flag wrapper, e.g. CTF{...}, or an empty string
+func GetFlagFormat() string {
+	return os.Getenv("FLAG_FORMAT")
+}
+
+// NormalizeFlag trims surrounding whitespace from a submitted flag
+func NormalizeFlag(flag string) string {
+	return strings.TrimSpace(flag)
+}
+
+// MatchesFlagFormat reports whether the flag is wrapped in the configured format
+func MatchesFlagFormat(flag string) bool {
+	format := GetFlagFormat()
+	if format == "" {
+		return true
+	}
+
+	prefix, suffix, found := strings.Cut(format, flagFormatPlaceholder)
+	if !found {
+		return strings.HasPrefix(flag, format)
+	}
+	return len(flag) > len(prefix)+len(suffix) &&
+		strings.HasPrefix(flag, prefix) &&
+		strings.HasSuffix(flag, suffix)
+}
+
+// WrapFlag places a flag body inside the configured flag format
+func WrapFlag(body string) string {
+	format := GetFlagFormat()
+	if !strings.Contains(format, flagFormatPlaceholder) {
+		return format + body
+	}
+	return strings.Replace(format, flagFormatPlaceholder, body, 1)
+}
+
+// derivedFlagBodyLength is the number of hex characters in a derived flag body
+const derivedFlagBodyLength = 32
+
+// IsDerivedFlagShape reports whether a flag has the shape DeriveFlag produces:
+// the flag format around 32 lowercase hex characters
+func IsDerivedFlagShape(flag string) bool {
+	format := GetFlagFormat()
+	prefix, suffix, found := strings.Cut(format, flagFormatPlaceholder)
+	if !found {
+		prefix, suffix = format, ""
+	}
+	if !strings.HasPrefix(flag, prefix) || !strings.HasSuffix(flag, suffix) ||
+		len(flag) != len(prefix)+derivedFlagBodyLength+len(suffix) {
+		return false
+	}
+	for _, r := range flag[len(prefix) : len(flag)-len(suffix)] {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// DeriveFlag computes the per-owner flag for a dynamic challenge flag as an
+// HMAC of the challenge secret, the challenge ID and the owner identifier
+func DeriveFlag(secret string, challengeID uint, owner string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatUint(uint64(challengeID), 10) + ":" + owner))
+	return WrapFlag(hex.EncodeToString(mac.Sum(nil))[:derivedFlagBodyLength])
+}
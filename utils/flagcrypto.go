@@ -0,0 +1,343 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Prefixes of sealed flag values stored in the database
+const (
+	hashedFlagPrefix    = "$sha256$"
+	encryptedFlagPrefix = "$enc$"
+)
+
+// ErrFlagNotReversible is returned when the plaintext of a hashed flag is requested
+var ErrFlagNotReversible = errors.New("flag is stored as a one-way hash")
+
+// KeyProvider supplies the symmetric keys used to encrypt flags at rest
+type KeyProvider interface {
+	// CurrentKey returns the key ID and key used for new encryptions
+	CurrentKey() (string, []byte, error)
+	// Key returns the key with the given ID for decryption
+	Key(kid string) ([]byte, error)
+}
+
+// ErrFlagKeyNotConfigured is returned outside development when neither FLAG_KEY
+// nor FLAG_KEY_FILE is set
+var ErrFlagKeyNotConfigured = errors.New("FLAG_KEY or FLAG_KEY_FILE must be set outside development")
+
+// StaticKeyProvider serves a single 32-byte AES key given in the configuration
+type StaticKeyProvider struct {
+	kid string
+	key []byte
+}
+
+// NewStaticKeyProvider creates a key provider from a hex or base64 encoded key
+func NewStaticKeyProvider(encoded string) (*StaticKeyProvider, error) {
+	key, err := parseFlagKey(encoded)
+	if err != nil {
+		return nil, errors.New("FLAG_KEY must be a 32-byte key in hex or base64")
+	}
+	return &StaticKeyProvider{kid: flagKeyID(key), key: key}, nil
+}
+
+// CurrentKey returns the configured key and its ID
+func (p *StaticKeyProvider) CurrentKey() (string, []byte, error) {
+	return p.kid, p.key, nil
+}
+
+// Key returns the configured key if the ID matches
+func (p *StaticKeyProvider) Key(kid string) ([]byte, error) {
+	if kid != p.kid {
+		return nil, fmt.Errorf("unknown flag key %q", kid)
+	}
+	return p.key, nil
+}
+
+// LocalFileKeyProvider reads a 32-byte AES key (hex or base64) from a local file.
+// With Generate set, a missing file is created with a random key on first use.
+type LocalFileKeyProvider struct {
+	Path     string
+	Generate bool
+
+	once sync.Once
+	kid  string
+	key  []byte
+	err  error
+}
+
+// NewLocalFileKeyProvider creates a key provider backed by an existing file
+func NewLocalFileKeyProvider(path string) *LocalFileKeyProvider {
+	return &LocalFileKeyProvider{Path: path}
+}
+
+// CurrentKey returns the file key and its ID
+func (p *LocalFileKeyProvider) CurrentKey() (string, []byte, error) {
+	p.once.Do(p.load)
+	return p.kid, p.key, p.err
+}
+
+// Key returns the file key if the ID matches
+func (p *LocalFileKeyProvider) Key(kid string) ([]byte, error) {
+	p.once.Do(p.load)
+	if p.err != nil {
+		return nil, p.err
+	}
+	if kid != p.kid {
+		return nil, fmt.Errorf("unknown flag key %q", kid)
+	}
+	return p.key, nil
+}
+
+// load reads the key file, creating it with a random key when missing and
+// generation is allowed
+func (p *LocalFileKeyProvider) load() {
+	data, err := os.ReadFile(p.Path)
+	if errors.Is(err, os.ErrNotExist) && p.Generate {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			p.err = err
+			return
+		}
+		if err := os.WriteFile(p.Path, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+			p.err = fmt.Errorf("failed to create flag key file: %w", err)
+			return
+		}
+		log.Printf("Generated new development flag encryption key at %s", p.Path)
+		data = []byte(hex.EncodeToString(key))
+	} else if err != nil {
+		p.err = fmt.Errorf("failed to read flag key file: %w", err)
+		return
+	}
+
+	key, err := parseFlagKey(string(data))
+	if err != nil {
+		p.err = errors.New("flag key file must contain a 32-byte key in hex or base64")
+		return
+	}
+	p.kid = flagKeyID(key)
+	p.key = key
+}
+
+// parseFlagKey decodes a 32-byte key given in hex or base64
+func parseFlagKey(encoded string) ([]byte, error) {
+	encoded = strings.TrimSpace(encoded)
+	key, err := hex.DecodeString(encoded)
+	if err != nil {
+		key, err = base64.StdEncoding.DecodeString(encoded)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, errors.New("key must be 32 bytes")
+	}
+	return key, nil
+}
+
+// flagKeyID identifies a key by a prefix of its SHA-256 digest
+func flagKeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:4])
+}
+
+// unconfiguredKeyProvider fails every request with the configuration error
+type unconfiguredKeyProvider struct {
+	err error
+}
+
+func (p unconfiguredKeyProvider) CurrentKey() (string, []byte, error) { return "", nil, p.err }
+func (p unconfiguredKeyProvider) Key(string) ([]byte, error)          { return nil, p.err }
+
+var (
+	flagKeyProvider     KeyProvider
+	flagKeyProviderOnce sync.Once
+)
+
+// GetFlagKeyProvider returns the key provider for flag encryption: the key in
+// FLAG_KEY, else the file in FLAG_KEY_FILE. Only with APP_ENV=development is a
+// key generated in flag.key when neither is set.
+func GetFlagKeyProvider() KeyProvider {
+	flagKeyProviderOnce.Do(func() {
+		if flagKeyProvider != nil {
+			return
+		}
+		if encoded := os.Getenv("FLAG_KEY"); encoded != "" {
+			provider, err := NewStaticKeyProvider(encoded)
+			if err != nil {
+				flagKeyProvider = unconfiguredKeyProvider{err: err}
+				return
+			}
+			flagKeyProvider = provider
+			return
+		}
+		if path := os.Getenv("FLAG_KEY_FILE"); path != "" {
+			flagKeyProvider = NewLocalFileKeyProvider(path)
+			return
+		}
+		if IsDevMode() {
+			flagKeyProvider = &LocalFileKeyProvider{Path: "flag.key", Generate: true}
+			return
+		}
+		flagKeyProvider = unconfiguredKeyProvider{err: ErrFlagKeyNotConfigured}
+	})
+	return flagKeyProvider
+}
+
+// SetFlagKeyProvider replaces the key provider, e.g. with a KMS-backed implementation
+func SetFlagKeyProvider(provider KeyProvider) {
+	flagKeyProvider = provider
+}
+
+// InitFlagKey checks at startup that the flag encryption key can be loaded
+func InitFlagKey() error {
+	_, _, err := GetFlagKeyProvider().CurrentKey()
+	return err
+}
+
+// IsSealedFlag reports whether a stored flag value is already hashed or encrypted
+func IsSealedFlag(value string) bool {
+	return strings.HasPrefix(value, hashedFlagPrefix) || strings.HasPrefix(value, encryptedFlagPrefix)
+}
+
+// IsHashedFlag reports whether a stored flag value is a one-way hash
+func IsHashedFlag(value string) bool {
+	return strings.HasPrefix(value, hashedFlagPrefix)
+}
+
+// HashFlag returns a salted SHA-256 hash of a flag in the form $sha256$<salt>$<digest>
+func HashFlag(flag string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return hashedFlagPrefix + base64.RawStdEncoding.EncodeToString(salt) + "$" + flagDigest(salt, flag), nil
+}
+
+// VerifyHashedFlag compares a flag with a salted hash in constant time
+func VerifyHashedFlag(hashed, flag string) bool {
+	salt64, digest, found := strings.Cut(strings.TrimPrefix(hashed, hashedFlagPrefix), "$")
+	if !found {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(salt64)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(flagDigest(salt, flag)), []byte(digest)) == 1
+}
+
+// flagDigest hashes the salt and flag together
+func flagDigest(salt []byte, flag string) string {
+	hash := sha256.New()
+	hash.Write(salt)
+	hash.Write([]byte(flag))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// EncryptFlag encrypts a flag with AES-256-GCM in the form $enc$<kid>$<nonce+ciphertext>
+func EncryptFlag(flag string) (string, error) {
+	return sealValue(encryptedFlagPrefix, "", flag)
+}
+
+// DecryptFlag reverses EncryptFlag; plaintext values are returned unchanged
+func DecryptFlag(value string) (string, error) {
+	if IsHashedFlag(value) {
+		return "", ErrFlagNotReversible
+	}
+	if !strings.HasPrefix(value, encryptedFlagPrefix) {
+		return value, nil
+	}
+	return openValue(encryptedFlagPrefix, "", value)
+}
+
+// purposeKey derives a separate key for a purpose from the flag key, so values
+// sealed for one purpose cannot be opened as another. Flags use the key as is.
+func purposeKey(key []byte, purpose string) []byte {
+	if purpose == "" {
+		return key
+	}
+	return hmacSHA256(key, purpose)
+}
+
+// sealValue encrypts a value with the current key derived for the purpose
+func sealValue(prefix, purpose, value string) (string, error) {
+	kid, key, err := GetFlagKeyProvider().CurrentKey()
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := newFlagCipher(purposeKey(key, purpose))
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(value), []byte(purpose+kid))
+	return prefix + kid + "$" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// openValue decrypts a value sealed by sealValue with the same prefix and purpose
+func openValue(prefix, purpose, value string) (string, error) {
+	kid, encoded, found := strings.Cut(strings.TrimPrefix(value, prefix), "$")
+	if !found {
+		return "", errors.New("invalid encrypted value format")
+	}
+
+	key, err := GetFlagKeyProvider().Key(kid)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := newFlagCipher(purposeKey(key, purpose))
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("invalid encrypted value format")
+	}
+
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(purpose+kid))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// newFlagCipher creates an AES-GCM cipher for the key
+func newFlagCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// GetFlagStorageMode returns FLAG_STORAGE: "hash" stores exact-match flags as
+// salted hashes, "encrypt" stores every flag encrypted
+func GetFlagStorageMode() string {
+	if strings.ToLower(os.Getenv("FLAG_STORAGE")) == "encrypt" {
+		return "encrypt"
+	}
+	return "hash"
+}
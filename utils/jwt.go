@@ -2,7 +2,6 @@ package utils
 
 import (
 	"errors"
-	"os"
 	"strconv"
 	"time"
 
@@ -11,32 +10,44 @@ import (
 
 // JWTClaims represents the JWT claims structure
 type JWTClaims struct {
-	UserID   uint   `json:"user_id"`
-	Username string `json:"username"`
-	IsAdmin  bool   `json:"is_admin"`
+	UserID    uint   `json:"user_id"`
+	Username  string `json:"username"`
+	IsAdmin   bool   `json:"is_admin"`
+	SessionID uint   `json:"sid"`
+	Version   uint   `json:"ver"`               // Must match the user's current token version
+	Purpose   string `json:"purpose,omitempty"` // Empty for access tokens
 	jwt.RegisteredClaims
 }
 
-// GetJWTSecret returns the JWT secret from environment variables
-func GetJWTSecret() string {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		// Default secret for development - should never be used in production
-		secret = "default-secret-change-in-production"
-	}
-	return secret
+// GetAccessTokenTTL returns how long access tokens are valid (ACCESS_TOKEN_TTL, default 15m)
+func GetAccessTokenTTL() time.Duration {
+	return GetEnvAsDuration("ACCESS_TOKEN_TTL", 15*time.Minute)
+}
+
+// GetRefreshTokenTTL returns how long refresh tokens are valid (REFRESH_TOKEN_TTL, default 7 days)
+func GetRefreshTokenTTL() time.Duration {
+	return GetEnvAsDuration("REFRESH_TOKEN_TTL", 7*24*time.Hour)
+}
+
+// PurposeMFAPending marks a token that only allows completing a two-factor login
+const PurposeMFAPending = "mfa_pending"
+
+// GetMFAPendingTTL returns how long a pending two-factor login stays valid (MFA_PENDING_TTL, default 5m)
+func GetMFAPendingTTL() time.Duration {
+	return GetEnvAsDuration("MFA_PENDING_TTL", 5*time.Minute)
 }
 
-// GenerateJWTToken creates a new JWT token for the user
-func GenerateJWTToken(userID uint, username string, isAdmin bool) (string, error) {
-	// Token expires in 24 hours
-	expirationTime := time.Now().Add(24 * time.Hour)
+// GenerateJWTToken creates a new short-lived access token for the user's session
+func GenerateJWTToken(userID uint, username string, isAdmin bool, sessionID, version uint) (string, error) {
+	expirationTime := time.Now().Add(GetAccessTokenTTL())
 
 	// Create the JWT claims
 	claims := &JWTClaims{
-		UserID:   userID,
-		Username: username,
-		IsAdmin:  isAdmin,
+		UserID:    userID,
+		Username:  username,
+		IsAdmin:   isAdmin,
+		SessionID: sessionID,
+		Version:   version,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -46,28 +57,39 @@ func GenerateJWTToken(userID uint, username string, isAdmin bool) (string, error
 		},
 	}
 
-	// Create token with claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	// Generate encoded token
-	tokenString, err := token.SignedString([]byte(GetJWTSecret()))
+	ring, err := GetKeyRing()
 	if err != nil {
 		return "", err
 	}
 
-	return tokenString, nil
+	// Sign with the current key from the key ring
+	return ring.Sign(claims)
 }
 
 // ValidateJWTToken validates and parses a JWT token
 func ValidateJWTToken(tokenString string) (*JWTClaims, error) {
-	// Parse the token
-	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// Validate the signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("invalid signing method")
-		}
-		return []byte(GetJWTSecret()), nil
-	})
+	claims, err := parseJWTToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	// Purpose-bound tokens (e.g. pending two-factor logins) are not access tokens
+	if claims.Purpose != "" {
+		return nil, errors.New("token cannot be used for authentication")
+	}
+
+	return claims, nil
+}
+
+// parseJWTToken verifies the signature and expiry of a token and returns its claims
+func parseJWTToken(tokenString string) (*JWTClaims, error) {
+	ring, err := GetKeyRing()
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the token, resolving the verification key by kid
+	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, ring.Keyfunc)
 
 	if err != nil {
 		return nil, err
@@ -92,14 +114,48 @@ func ValidateJWTToken(tokenString string) (*JWTClaims, error) {
 	return claims, nil
 }
 
-// RefreshJWTToken creates a new token with extended expiration
-func RefreshJWTToken(oldTokenString string) (string, error) {
-	// Validate the old token
-	claims, err := ValidateJWTToken(oldTokenString)
+// GenerateMFAPendingToken creates a short-lived token proving the password
+// step of a login succeeded; it cannot be used as an access token
+func GenerateMFAPendingToken(userID uint, username string, version uint) (string, error) {
+	now := time.Now()
+	claims := &JWTClaims{
+		UserID:   userID,
+		Username: username,
+		Version:  version,
+		Purpose:  PurposeMFAPending,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(GetMFAPendingTTL())),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    "ctf-backend",
+			Subject:   strconv.Itoa(int(userID)),
+		},
+	}
+
+	ring, err := GetKeyRing()
 	if err != nil {
 		return "", err
 	}
+	return ring.Sign(claims)
+}
+
+// ValidateMFAPendingToken validates a token issued by GenerateMFAPendingToken
+func ValidateMFAPendingToken(tokenString string) (*JWTClaims, error) {
+	claims, err := parseJWTToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != PurposeMFAPending {
+		return nil, errors.New("not a two-factor login token")
+	}
+	return claims, nil
+}
 
-	// Generate a new token with the same user information
-	return GenerateJWTToken(claims.UserID, claims.Username, claims.IsAdmin)
+// GenerateRefreshToken creates an opaque refresh token and the hash to store
+func GenerateRefreshToken() (string, string, error) {
+	token, err := GenerateRandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	return token, HashToken(token), nil
 }
@@ -0,0 +1,516 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported JWT signing algorithms
+const (
+	AlgEdDSA = "EdDSA"
+	AlgRS256 = "RS256"
+	AlgHS256 = "HS256"
+)
+
+// defaultJWTSecret is the development fallback for HS256 signing
+const defaultJWTSecret = "default-secret-change-in-production"
+
+// SigningKey is one key in the JWT key ring
+type SigningKey struct {
+	KID         string     `json:"kid"`
+	Algorithm   string     `json:"alg"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ActivatesAt time.Time  `json:"activates_at"`         // Published in the JWKS before this, signs from then on
+	RetiredAt   *time.Time `json:"retired_at,omitempty"` // Set to when a newer key takes over signing
+
+	private crypto.Signer
+}
+
+// PrivateKeyPEM encodes the private key as PKCS#8 PEM for a key store
+func (k *SigningKey) PrivateKeyPEM() ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(k.private)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// SetPrivateKeyPEM decodes the PKCS#8 PEM private key loaded by a key store
+func (k *SigningKey) SetPrivateKeyPEM(data []byte) error {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return fmt.Errorf("invalid PEM for JWT key %s", k.KID)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("invalid JWT key %s: %w", k.KID, err)
+	}
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("unsupported JWT key type for %s", k.KID)
+	}
+	k.private = signer
+	return nil
+}
+
+// Signing keys are sealed with their own key derived from the flag key when
+// stored outside the key directory
+const (
+	sealedSigningKeyPrefix = "$jwk$"
+	signingKeyPurpose      = "jwt-signing-keys"
+)
+
+// SealPrivateKey encrypts the private key for storage in the form $jwk$<kid>$<nonce+ciphertext>
+func (k *SigningKey) SealPrivateKey() (string, error) {
+	data, err := k.PrivateKeyPEM()
+	if err != nil {
+		return "", err
+	}
+	return sealValue(sealedSigningKeyPrefix, signingKeyPurpose, string(data))
+}
+
+// OpenPrivateKey decrypts a private key sealed by SealPrivateKey into the key
+func (k *SigningKey) OpenPrivateKey(sealed string) error {
+	data, err := openValue(sealedSigningKeyPrefix, signingKeyPurpose, sealed)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt JWT key %s: %w", k.KID, err)
+	}
+	return k.SetPrivateKeyPEM([]byte(data))
+}
+
+// KeyStore persists the key ring. Every instance loads its keys from the store,
+// so a store shared between instances makes them sign and verify alike.
+type KeyStore interface {
+	// Load returns the stored keys
+	Load() ([]*SigningKey, error)
+	// Update calls fn with the stored keys under a lock held against every
+	// instance sharing the store and stores the keys it returns. A nil result
+	// leaves the store unchanged. Update returns the stored keys.
+	Update(fn func(keys []*SigningKey) ([]*SigningKey, error)) ([]*SigningKey, error)
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	KTY string `json:"kty"`
+	KID string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// KeyRing holds the JWT signing keys. A new key is published in the JWKS one
+// cache period before it takes over signing, and retired keys keep validating
+// tokens until those tokens can have expired.
+type KeyRing struct {
+	mutex      sync.RWMutex
+	algorithm  string
+	store      KeyStore
+	keys       []*SigningKey
+	hmacKey    []byte
+	lastReload time.Time
+}
+
+var (
+	keyRing     *KeyRing
+	keyRingOnce sync.Once
+	keyRingErr  error
+	keyStore    KeyStore
+)
+
+// keyReloadInterval limits reloads triggered by tokens signed with an unknown key
+const keyReloadInterval = 5 * time.Second
+
+// IsDevMode reports whether the application runs in development mode (APP_ENV=development)
+func IsDevMode() bool {
+	return strings.EqualFold(os.Getenv("APP_ENV"), "development")
+}
+
+// GetJWTSigningAlgorithm returns JWT_SIGNING_ALG (EdDSA, RS256 or HS256), defaulting to EdDSA
+func GetJWTSigningAlgorithm() string {
+	switch strings.ToUpper(os.Getenv("JWT_SIGNING_ALG")) {
+	case "RS256":
+		return AlgRS256
+	case "HS256":
+		return AlgHS256
+	default:
+		return AlgEdDSA
+	}
+}
+
+// GetKeyRotationInterval returns how often signing keys rotate (JWT_KEY_ROTATION_INTERVAL, default 30 days)
+func GetKeyRotationInterval() time.Duration {
+	return GetEnvAsDuration("JWT_KEY_ROTATION_INTERVAL", 30*24*time.Hour)
+}
+
+// GetJWKSCacheTTL returns how long clients may cache the JWKS (JWKS_CACHE_TTL,
+// default 10m). New signing keys are published this long before they sign.
+func GetJWKSCacheTTL() time.Duration {
+	return GetEnvAsDuration("JWKS_CACHE_TTL", 10*time.Minute)
+}
+
+// SetKeyStore replaces the key store, e.g. with a database-backed store shared
+// by every instance. It must be called before the key ring is initialized.
+func SetKeyStore(store KeyStore) {
+	keyStore = store
+}
+
+// InitKeyRing loads (or creates) the JWT key ring. It refuses to use the
+// default HS256 secret outside development mode.
+func InitKeyRing() error {
+	keyRingOnce.Do(func() {
+		keyRing, keyRingErr = loadKeyRing()
+	})
+	return keyRingErr
+}
+
+// GetKeyRing returns the initialized key ring
+func GetKeyRing() (*KeyRing, error) {
+	if err := InitKeyRing(); err != nil {
+		return nil, err
+	}
+	return keyRing, nil
+}
+
+// loadKeyRing builds the key ring from configuration and the key directory
+func loadKeyRing() (*KeyRing, error) {
+	ring := &KeyRing{algorithm: GetJWTSigningAlgorithm()}
+
+	if ring.algorithm == AlgHS256 {
+		secret := os.Getenv("JWT_SECRET")
+		if secret == "" || secret == defaultJWTSecret {
+			if !IsDevMode() {
+				return nil, errors.New("refusing to start with the default JWT secret; set JWT_SECRET or use an asymmetric JWT_SIGNING_ALG")
+			}
+			log.Println("Warning: using the default JWT secret (development mode only)")
+			secret = defaultJWTSecret
+		}
+		ring.hmacKey = []byte(secret)
+		return ring, nil
+	}
+
+	ring.store = keyStore
+	if ring.store == nil {
+		dir := os.Getenv("JWT_KEY_DIR")
+		if dir == "" {
+			dir = "keys"
+		}
+		store, err := NewFileKeyStore(dir)
+		if err != nil {
+			return nil, err
+		}
+		ring.store = store
+	}
+
+	if err := ring.Reload(); err != nil {
+		return nil, err
+	}
+	if err := ring.RotateIfDue(); err != nil {
+		return nil, err
+	}
+	return ring, nil
+}
+
+// Reload replaces the keys with those in the store, picking up keys rotated by
+// other instances
+func (kr *KeyRing) Reload() error {
+	if kr.algorithm == AlgHS256 {
+		return nil
+	}
+
+	keys, err := kr.store.Load()
+	if err != nil {
+		return err
+	}
+	kr.setKeys(keys)
+	return nil
+}
+
+// setKeys replaces the keys, ordered by activation
+func (kr *KeyRing) setKeys(keys []*SigningKey) {
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].ActivatesAt.Before(keys[j].ActivatesAt) })
+
+	kr.mutex.Lock()
+	defer kr.mutex.Unlock()
+	kr.keys = keys
+	kr.lastReload = time.Now()
+}
+
+// generateKey creates a new private key for the configured algorithm
+func (kr *KeyRing) generateKey(now, activatesAt time.Time) (*SigningKey, error) {
+	var signer crypto.Signer
+	var err error
+	switch kr.algorithm {
+	case AlgRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	suffix, err := GenerateRandomToken(4)
+	if err != nil {
+		return nil, err
+	}
+	return &SigningKey{
+		KID:         now.Format("20060102") + "-" + suffix,
+		Algorithm:   kr.algorithm,
+		CreatedAt:   now,
+		ActivatesAt: activatesAt,
+		private:     signer,
+	}, nil
+}
+
+// current returns the signing key: the last activated key of the configured
+// algorithm that has not been retired
+func (kr *KeyRing) current(now time.Time) *SigningKey {
+	var current *SigningKey
+	for _, key := range kr.keys {
+		if key.Algorithm != kr.algorithm || key.ActivatesAt.After(now) {
+			continue
+		}
+		if key.RetiredAt != nil && !key.RetiredAt.After(now) {
+			continue
+		}
+		current = key
+	}
+	return current
+}
+
+// latestKey returns the key of the algorithm activating last, which
+// may still be waiting to sign
+func latestKey(keys []*SigningKey, algorithm string) *SigningKey {
+	var latest *SigningKey
+	for _, key := range keys {
+		if key.Algorithm == algorithm && (latest == nil || key.ActivatesAt.After(latest.ActivatesAt)) {
+			latest = key
+		}
+	}
+	return latest
+}
+
+// Rotate publishes a new signing key that takes over signing one JWKS cache
+// period from now, retiring the keys signing until then
+func (kr *KeyRing) Rotate() error {
+	return kr.rotate(true)
+}
+
+// RotateIfDue publishes the next signing key one JWKS cache period before the
+// current one reaches the rotation interval, or a key signing immediately when
+// there is none
+func (kr *KeyRing) RotateIfDue() error {
+	return kr.rotate(false)
+}
+
+// rotate adds the next key to the store under its lock, so instances sharing
+// the store rotate once between them
+func (kr *KeyRing) rotate(force bool) error {
+	if kr.algorithm == AlgHS256 {
+		if force {
+			return errors.New("key rotation requires an asymmetric JWT_SIGNING_ALG")
+		}
+		return nil
+	}
+
+	var rotated *SigningKey
+	keys, err := kr.store.Update(func(keys []*SigningKey) ([]*SigningKey, error) {
+		now := time.Now().UTC()
+		lead := GetJWKSCacheTTL()
+
+		// The first key signs at once as no client can have cached the key set
+		activatesAt := now
+		if latest := latestKey(keys, kr.algorithm); latest != nil {
+			next := latest.ActivatesAt.Add(GetKeyRotationInterval())
+			if !force && (latest.ActivatesAt.After(now) || now.Before(next.Add(-lead))) {
+				return nil, nil
+			}
+			activatesAt = now.Add(lead)
+			if !force && next.After(activatesAt) {
+				activatesAt = next
+			}
+		}
+
+		key, err := kr.generateKey(now, activatesAt)
+		if err != nil {
+			return nil, err
+		}
+		for _, existing := range keys {
+			if existing.RetiredAt == nil || existing.RetiredAt.After(activatesAt) {
+				retiredAt := activatesAt
+				existing.RetiredAt = &retiredAt
+			}
+		}
+		rotated = key
+		return pruneKeys(append(keys, key), now), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	kr.setKeys(keys)
+	if rotated != nil {
+		log.Printf("Published JWT signing key kid=%s, signing from %s", rotated.KID, rotated.ActivatesAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// pruneKeys drops retired keys whose tokens have all expired
+func pruneKeys(keys []*SigningKey, now time.Time) []*SigningKey {
+	kept := keys[:0]
+	for _, key := range keys {
+		if key.RetiredAt != nil && now.Sub(*key.RetiredAt) > GetAccessTokenTTL() {
+			continue
+		}
+		kept = append(kept, key)
+	}
+	return kept
+}
+
+// validKeys returns the keys still accepted for verification
+func (kr *KeyRing) validKeys() []*SigningKey {
+	now := time.Now()
+	var keys []*SigningKey
+	for _, key := range kr.keys {
+		if key.RetiredAt == nil || now.Sub(*key.RetiredAt) <= GetAccessTokenTTL() {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Sign signs the claims with the current key and sets the kid header
+func (kr *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	if kr.algorithm == AlgHS256 {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(kr.hmacKey)
+	}
+
+	kr.mutex.RLock()
+	key := kr.current(time.Now())
+	kr.mutex.RUnlock()
+	if key == nil {
+		return "", errors.New("no JWT signing key available")
+	}
+
+	token := jwt.NewWithClaims(signingMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.KID
+	return token.SignedString(key.private)
+}
+
+// Keyfunc resolves the verification key of a token from its kid header
+func (kr *KeyRing) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if kr.algorithm == AlgHS256 {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("invalid signing method")
+		}
+		return kr.hmacKey, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+
+	key, stale := kr.verificationKey(kid)
+	if key == nil && stale {
+		// The token may be signed with a key another instance has just published
+		if err := kr.Reload(); err != nil {
+			log.Printf("Failed to reload JWT signing keys: %v", err)
+		}
+		key, _ = kr.verificationKey(kid)
+	}
+	if key == nil {
+		return nil, errors.New("unknown signing key")
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, errors.New("invalid signing method")
+	}
+	return key.private.Public(), nil
+}
+
+// verificationKey finds a valid key by ID and reports whether the keys are due
+// for a reload when it is missing
+func (kr *KeyRing) verificationKey(kid string) (*SigningKey, bool) {
+	kr.mutex.RLock()
+	defer kr.mutex.RUnlock()
+
+	for _, key := range kr.validKeys() {
+		if key.KID == kid {
+			return key, false
+		}
+	}
+	return nil, time.Since(kr.lastReload) > keyReloadInterval
+}
+
+// JWKS returns the public keys still accepted for verification
+func (kr *KeyRing) JWKS() []JWK {
+	kr.mutex.RLock()
+	defer kr.mutex.RUnlock()
+
+	jwks := []JWK{}
+	for _, key := range kr.validKeys() {
+		jwk := JWK{KID: key.KID, Alg: key.Algorithm, Use: "sig"}
+		switch public := key.private.Public().(type) {
+		case ed25519.PublicKey:
+			jwk.KTY = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		case *rsa.PublicKey:
+			jwk.KTY = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		default:
+			continue
+		}
+		jwks = append(jwks, jwk)
+	}
+
+	sort.Slice(jwks, func(i, j int) bool { return jwks[i].KID < jwks[j].KID })
+	return jwks
+}
+
+// StartKeyRotation periodically reloads the keys from the store and publishes
+// the next signing key when it is due
+func StartKeyRotation(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			ring, err := GetKeyRing()
+			if err != nil {
+				continue
+			}
+			if err := ring.Reload(); err != nil {
+				log.Printf("Failed to reload JWT signing keys: %v", err)
+				continue
+			}
+			if err := ring.RotateIfDue(); err != nil {
+				log.Printf("Failed to rotate JWT signing key: %v", err)
+			}
+		}
+	}()
+}
+
+// signingMethod maps an algorithm name to its jwt signing method
+func signingMethod(algorithm string) jwt.SigningMethod {
+	if algorithm == AlgRS256 {
+		return jwt.SigningMethodRS256
+	}
+	return jwt.SigningMethodEdDSA
+}
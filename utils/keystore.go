@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileKeyStore keeps the key ring in a directory: a keyring.json manifest and
+// one PEM file per key. It only locks within the process, so instances sharing
+// the directory can rotate at the same time; use the database store for those.
+type FileKeyStore struct {
+	Dir string
+
+	mutex sync.Mutex
+}
+
+// NewFileKeyStore creates a key store in the directory, creating it if needed
+func NewFileKeyStore(dir string) (*FileKeyStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create JWT key directory: %w", err)
+	}
+	return &FileKeyStore{Dir: dir}, nil
+}
+
+// manifestPath returns the path of the key ring manifest
+func (s *FileKeyStore) manifestPath() string {
+	return filepath.Join(s.Dir, "keyring.json")
+}
+
+// keyPath returns the path of a private key
+func (s *FileKeyStore) keyPath(kid string) string {
+	return filepath.Join(s.Dir, kid+".pem")
+}
+
+// Load reads the manifest and private keys from disk
+func (s *FileKeyStore) Load() ([]*SigningKey, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.load()
+}
+
+// Update changes the keys on disk under the process-wide lock
+func (s *FileKeyStore) Update(fn func(keys []*SigningKey) ([]*SigningKey, error)) ([]*SigningKey, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	keys, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	previous := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		previous[key.KID] = true
+	}
+
+	updated, err := fn(keys)
+	if err != nil || updated == nil {
+		return keys, err
+	}
+
+	kept := make(map[string]bool, len(updated))
+	for _, key := range updated {
+		kept[key.KID] = true
+		if previous[key.KID] {
+			continue
+		}
+		data, err := key.PrivateKeyPEM()
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(s.keyPath(key.KID), data, 0600); err != nil {
+			return nil, fmt.Errorf("failed to write JWT key: %w", err)
+		}
+	}
+
+	data, err := json.MarshalIndent(updated, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(s.manifestPath(), data, 0600); err != nil {
+		return nil, err
+	}
+
+	for kid := range previous {
+		if !kept[kid] {
+			os.Remove(s.keyPath(kid))
+		}
+	}
+	return updated, nil
+}
+
+// load reads the manifest and private keys from disk
+func (s *FileKeyStore) load() ([]*SigningKey, error) {
+	data, err := os.ReadFile(s.manifestPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWT key manifest: %w", err)
+	}
+
+	var keys []*SigningKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("invalid JWT key manifest: %w", err)
+	}
+
+	for _, key := range keys {
+		pemData, err := os.ReadFile(s.keyPath(key.KID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT key %s: %w", key.KID, err)
+		}
+		if err := key.SetPrivateKeyPEM(pemData); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mailer sends plain-text emails
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// SMTPMailer sends emails through an SMTP server
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send delivers the email, authenticating when a username is configured
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	message := strings.Join([]string{
+		"From: " + m.From,
+		"To: " + to,
+		"Subject: " + subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	// The envelope sender must be a bare address, the header may include a name
+	sender := m.From
+	if address, err := mail.ParseAddress(m.From); err == nil {
+		sender = address.Address
+	}
+
+	return smtp.SendMail(net.JoinHostPort(m.Host, m.Port), auth, sender, []string{to}, []byte(message))
+}
+
+// LogMailer writes emails to a file, or to the application log when no path
+// is set; intended for development and tests
+type LogMailer struct {
+	Path string
+
+	mutex sync.Mutex
+}
+
+// Send records the email instead of delivering it
+func (m *LogMailer) Send(to, subject, body string) error {
+	entry := fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n", to, subject, body)
+	if m.Path == "" {
+		log.Printf("Email (not sent):\n%s", entry)
+		return nil
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	file, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(entry + "----\n")
+	return err
+}
+
+var (
+	mailer     Mailer
+	mailerOnce sync.Once
+)
+
+// GetMailer returns the configured mailer (MAILER=smtp or log, default log)
+func GetMailer() Mailer {
+	mailerOnce.Do(func() {
+		if mailer != nil {
+			return
+		}
+		if strings.ToLower(os.Getenv("MAILER")) == "smtp" {
+			port := os.Getenv("SMTP_PORT")
+			if port == "" {
+				port = "587"
+			}
+			mailer = &SMTPMailer{
+				Host:     os.Getenv("SMTP_HOST"),
+				Port:     port,
+				Username: os.Getenv("SMTP_USERNAME"),
+				Password: os.Getenv("SMTP_PASSWORD"),
+				From:     os.Getenv("SMTP_FROM"),
+			}
+			return
+		}
+		mailer = &LogMailer{Path: os.Getenv("MAIL_LOG_FILE")}
+	})
+	return mailer
+}
+
+// SetMailer replaces the mailer, e.g. with a transactional email service
+func SetMailer(m Mailer) {
+	mailer = m
+}
+
+// GetAppURL returns the public frontend URL used in email links (APP_URL, default http://localhost:3000)
+func GetAppURL() string {
+	appURL := os.Getenv("APP_URL")
+	if appURL == "" {
+		appURL = "http://localhost:3000"
+	}
+	return strings.TrimRight(appURL, "/")
+}
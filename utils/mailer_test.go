@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogMailerAppendsEmails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+	mailer := &LogMailer{Path: path}
+
+	if err := mailer.Send("a@example.com", "First", "one"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mailer.Send("b@example.com", "Second", "two"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := strings.Split(strings.TrimSuffix(string(data), "----\n"), "----\n")
+	if len(entries) != 2 {
+		t.Fatalf("want 2 entries, got %d: %q", len(entries), data)
+	}
+	if !strings.HasPrefix(entries[1], "To: b@example.com\nSubject: Second\n\ntwo") {
+		t.Fatalf("unexpected entry %q", entries[1])
+	}
+}
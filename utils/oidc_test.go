@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIssuer is a local OpenID Connect provider that signs ID tokens with an
+// RSA key and returns the next ID token from its token endpoint
+type mockIssuer struct {
+	server  *httptest.Server
+	key     *rsa.PrivateKey
+	idToken string
+	form    map[string]string // Last token request
+}
+
+// newMockIssuer starts an issuer serving discovery, JWKS and token endpoints
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &mockIssuer{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer.server.URL,
+			"authorization_endpoint": issuer.server.URL + "/authorize",
+			"token_endpoint":         issuer.server.URL + "/token",
+			"jwks_uri":               issuer.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		issuer.form = map[string]string{}
+		for name := range r.PostForm {
+			issuer.form[name] = r.PostForm.Get(name)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": issuer.idToken})
+	})
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+// provider returns a client of the issuer
+func (m *mockIssuer) provider() *OIDCProvider {
+	return &OIDCProvider{
+		Name:        "mock",
+		Issuer:      m.server.URL,
+		ClientID:    "ctf-client",
+		RedirectURL: "http://localhost:3000/auth/oidc/mock/callback",
+	}
+}
+
+// claims returns valid ID token claims for the issuer
+func (m *mockIssuer) claims(nonce string) *OIDCClaims {
+	now := time.Now()
+	return &OIDCClaims{
+		Email:         "player@example.com",
+		EmailVerified: true,
+		Nonce:         nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    m.server.URL,
+			Subject:   "subject-1",
+			Audience:  jwt.ClaimStrings{"ctf-client"},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+	}
+}
+
+// sign signs claims with the key, using the issuer's key ID
+func sign(t *testing.T, key *rsa.PrivateKey, claims jwt.Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test-key"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestOIDCExchangeVerifiesIDToken(t *testing.T) {
+	issuer := newMockIssuer(t)
+	issuer.idToken = sign(t, issuer.key, issuer.claims("nonce-1"))
+
+	claims, err := issuer.provider().Exchange("code-1", "verifier-1", "nonce-1")
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	if claims.Subject != "subject-1" || claims.Email != "player@example.com" {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+	if issuer.form["code"] != "code-1" || issuer.form["code_verifier"] != "verifier-1" || issuer.form["client_id"] != "ctf-client" {
+		t.Fatalf("unexpected token request %v", issuer.form)
+	}
+}
+
+func TestOIDCVerifyIDTokenRejections(t *testing.T) {
+	issuer := newMockIssuer(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		key    *rsa.PrivateKey
+		nonce  string
+		modify func(*OIDCClaims)
+	}{
+		{name: "foreign signature", key: otherKey, nonce: "nonce-1"},
+		{name: "nonce mismatch", key: issuer.key, nonce: "other-nonce"},
+		{name: "wrong issuer", key: issuer.key, nonce: "nonce-1", modify: func(c *OIDCClaims) { c.Issuer = "https://evil.example.com" }},
+		{name: "wrong audience", key: issuer.key, nonce: "nonce-1", modify: func(c *OIDCClaims) { c.Audience = jwt.ClaimStrings{"other-client"} }},
+		{name: "expired", key: issuer.key, nonce: "nonce-1", modify: func(c *OIDCClaims) {
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+		}},
+		{name: "no subject", key: issuer.key, nonce: "nonce-1", modify: func(c *OIDCClaims) { c.Subject = "" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := issuer.claims("nonce-1")
+			if tt.modify != nil {
+				tt.modify(claims)
+			}
+			if _, err := issuer.provider().VerifyIDToken(sign(t, tt.key, claims), tt.nonce); err == nil {
+				t.Fatal("want the ID token to be rejected")
+			}
+		})
+	}
+}
+
+func TestOIDCVerifyIDTokenRejectsUnsignedToken(t *testing.T) {
+	issuer := newMockIssuer(t)
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, issuer.claims("nonce-1")).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issuer.provider().VerifyIDToken(unsigned, "nonce-1"); err == nil {
+		t.Fatal("want the unsigned ID token to be rejected")
+	}
+}
+
+func TestOIDCDiscoveryRejectsIssuerMismatch(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider := issuer.provider()
+	provider.Issuer = strings.Replace(issuer.server.URL, "127.0.0.1", "localhost", 1)
+
+	if _, err := provider.AuthorizationURL("state", "nonce", "challenge"); err == nil {
+		t.Fatal("want discovery to reject a document for another issuer")
+	}
+}
@@ -0,0 +1,398 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidStorageKey is returned for keys that are empty or escape the storage root
+var ErrInvalidStorageKey = errors.New("invalid storage key")
+
+// Storage stores uploaded files under slash-separated keys
+type Storage interface {
+	Put(key string, content io.Reader, size int64, contentType string) error
+	Open(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+// validStorageKey reports whether a key is relative and stays inside the storage root
+func validStorageKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// LocalStorage keeps files in a directory on the local filesystem
+type LocalStorage struct {
+	Dir string
+}
+
+// path maps a key to a file below the storage directory
+func (s *LocalStorage) path(key string) (string, error) {
+	if !validStorageKey(key) {
+		return "", ErrInvalidStorageKey
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes the file through a temporary file so readers never see partial content
+func (s *LocalStorage) Put(key string, content io.Reader, size int64, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	written, err := io.Copy(file, content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if size >= 0 && written != size {
+		return fmt.Errorf("wrote %d bytes, expected %d", written, size)
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// Open returns the stored file
+func (s *LocalStorage) Open(key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// Delete removes the stored file; deleting a missing file is not an error
+func (s *LocalStorage) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// S3Storage keeps files in a bucket of an S3-compatible object store
+// (AWS S3, MinIO, ...), signing requests with AWS Signature Version 4
+type S3Storage struct {
+	Endpoint        string // e.g. https://s3.eu-west-1.amazonaws.com or http://localhost:9000
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	PathStyle       bool // Address the bucket in the path instead of the host name
+
+	Client *http.Client
+}
+
+// unsignedPayload skips hashing request bodies, which are streamed
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// objectURL returns the URL of an object
+func (s *S3Storage) objectURL(key string) (*url.URL, error) {
+	if !validStorageKey(key) {
+		return nil, ErrInvalidStorageKey
+	}
+	endpoint, err := url.Parse(strings.TrimRight(s.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Send the path escaped exactly as SignS3Request canonicalizes it
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = s3Escape(segment)
+	}
+	escapedKey := strings.Join(segments, "/")
+	escapedBase := strings.TrimRight(endpoint.EscapedPath(), "/")
+
+	if s.PathStyle {
+		endpoint.Path = strings.TrimRight(endpoint.Path, "/") + "/" + s.Bucket + "/" + key
+		endpoint.RawPath = escapedBase + "/" + s3Escape(s.Bucket) + "/" + escapedKey
+	} else {
+		endpoint.Host = s.Bucket + "." + endpoint.Host
+		endpoint.Path = strings.TrimRight(endpoint.Path, "/") + "/" + key
+		endpoint.RawPath = escapedBase + "/" + escapedKey
+	}
+	return endpoint, nil
+}
+
+// do sends a signed request for an object and fails on non-2xx responses
+func (s *S3Storage) do(method, key string, body io.Reader, size int64, contentType string) (*http.Response, error) {
+	objectURL, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(method, objectURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+	}
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	SignS3Request(req, s.Region, s.AccessKeyID, s.SecretAccessKey, time.Now())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s returned %s: %s", method, key, resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+// Put uploads the object
+func (s *S3Storage) Put(key string, content io.Reader, size int64, contentType string) error {
+	resp, err := s.do(http.MethodPut, key, content, size, contentType)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Open downloads the object
+func (s *S3Storage) Open(key string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, key, nil, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Delete removes the object; S3 reports success for missing objects
+func (s *S3Storage) Delete(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil, 0, "")
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// SignS3Request adds an AWS Signature Version 4 Authorization header for the
+// s3 service. The host and every header already set on the request are signed;
+// X-Amz-Content-Sha256 must be set to the payload hash or UNSIGNED-PAYLOAD.
+func SignS3Request(req *http.Request, region, accessKeyID, secretAccessKey string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.EscapedPath()),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data under key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3EscapePath re-encodes an escaped path the way SigV4 expects (RFC 3986, keeping slashes)
+func s3EscapePath(escaped string) string {
+	if escaped == "" {
+		return "/"
+	}
+	unescaped, err := url.PathUnescape(escaped)
+	if err != nil {
+		return escaped
+	}
+	parts := strings.Split(unescaped, "/")
+	for i, part := range parts {
+		parts[i] = s3Escape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+// s3CanonicalQuery sorts and encodes query parameters the way SigV4 expects
+func s3CanonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, s3Escape(name)+"="+s3Escape(value))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// s3Escape percent-encodes everything but RFC 3986 unreserved characters
+func s3Escape(value string) string {
+	var escaped strings.Builder
+	for _, b := range []byte(value) {
+		if ('A' <= b && b <= 'Z') || ('a' <= b && b <= 'z') || ('0' <= b && b <= '9') ||
+			b == '-' || b == '_' || b == '.' || b == '~' {
+			escaped.WriteByte(b)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
+
+var (
+	storage     Storage
+	storageOnce sync.Once
+)
+
+// GetStorage returns the configured file storage (STORAGE_BACKEND=local or s3, default local)
+func GetStorage() Storage {
+	storageOnce.Do(func() {
+		if storage != nil {
+			return
+		}
+		if strings.ToLower(os.Getenv("STORAGE_BACKEND")) == "s3" {
+			region := os.Getenv("S3_REGION")
+			if region == "" {
+				region = "us-east-1"
+			}
+			storage = &S3Storage{
+				Endpoint:        os.Getenv("S3_ENDPOINT"),
+				Region:          region,
+				Bucket:          os.Getenv("S3_BUCKET"),
+				AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+				SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+				PathStyle:       GetEnvAsBool("S3_FORCE_PATH_STYLE", false),
+				Client:          &http.Client{Timeout: 5 * time.Minute},
+			}
+			return
+		}
+		dir := os.Getenv("STORAGE_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		storage = &LocalStorage{Dir: dir}
+	})
+	return storage
+}
+
+// SetStorage replaces the file storage, e.g. with another object store
+func SetStorage(s Storage) {
+	storage = s
+}
+
+// GetFileURLTTL returns how long signed download URLs stay valid (FILE_URL_TTL, default 15m)
+func GetFileURLTTL() time.Duration {
+	return GetEnvAsDuration("FILE_URL_TTL", 15*time.Minute)
+}
+
+// fileURLKey returns the key signing download URLs: FILE_URL_SECRET, or a key
+// derived from the flag encryption key so every instance agrees without extra setup
+func fileURLKey() ([]byte, error) {
+	if secret := os.Getenv("FILE_URL_SECRET"); secret != "" {
+		return []byte(secret), nil
+	}
+	_, key, err := GetFlagKeyProvider().CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	return hmacSHA256(key, "challenge-file-urls"), nil
+}
+
+// fileSignature authenticates a download of a file by a user (0 for anonymous) until expires
+func fileSignature(key []byte, fileID, userID uint, expires int64) string {
+	return hex.EncodeToString(hmacSHA256(key, fmt.Sprintf("%d:%d:%d", fileID, userID, expires)))
+}
+
+// SignFileURL returns the query string of a download URL for the file that is valid until expires
+func SignFileURL(fileID, userID uint, expires time.Time) (string, error) {
+	key, err := fileURLKey()
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{}
+	query.Set("user", fmt.Sprint(userID))
+	query.Set("expires", fmt.Sprint(expires.Unix()))
+	query.Set("signature", fileSignature(key, fileID, userID, expires.Unix()))
+	return query.Encode(), nil
+}
+
+// VerifyFileSignature checks a download URL signature and that it has not expired
+func VerifyFileSignature(fileID, userID uint, expires int64, signature string, now time.Time) bool {
+	if now.Unix() > expires {
+		return false
+	}
+	key, err := fileURLKey()
+	if err != nil {
+		return false
+	}
+	expected := fileSignature(key, fileID, userID, expires)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
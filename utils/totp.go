@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// TOTP parameters (RFC 6238 defaults understood by every authenticator app)
+const (
+	totpDigits = 6
+	totpPeriod = 30 * time.Second
+	totpSkew   = 1 // Accepted time steps before and after the current one
+)
+
+// totpEncoding is unpadded base32, the secret format used in provisioning URIs
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GetTOTPIssuer returns the issuer shown in authenticator apps (TOTP_ISSUER, default "CTF")
+func GetTOTPIssuer() string {
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "CTF"
+	}
+	return issuer
+}
+
+// IsAdminMFARequired reports whether admins must have two-factor authentication
+// enabled to use admin routes (REQUIRE_ADMIN_2FA, default true)
+func IsAdminMFARequired() bool {
+	return GetEnvAsBool("REQUIRE_ADMIN_2FA", true)
+}
+
+// GenerateTOTPSecret creates a random 160-bit base32 TOTP secret
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPProvisioningURI returns the otpauth:// URI to render as a QR code
+func TOTPProvisioningURI(account, secret string) string {
+	issuer := GetTOTPIssuer()
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// totpCounter returns the time step of the given time
+func totpCounter(t time.Time) int64 {
+	return t.Unix() / int64(totpPeriod.Seconds())
+}
+
+// hotp computes an RFC 4226 one-time password for the counter
+func hotp(key []byte, counter int64) string {
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:], uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, code%1000000)
+}
+
+// GenerateTOTPCode returns the code for the secret at the given time
+func GenerateTOTPCode(secret string, t time.Time) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, totpCounter(t)), nil
+}
+
+// VerifyTOTPCode checks a code against the secret, allowing one step of clock
+// skew. Codes at or before lastCounter are rejected so a code cannot be
+// replayed; the matched counter is returned to be stored as the new lastCounter.
+func VerifyTOTPCode(secret, code string, now time.Time, lastCounter int64) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := totpCounter(now)
+	for counter := current - totpSkew; counter <= current+totpSkew; counter++ {
+		if counter <= lastCounter {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(hotp(key, counter)), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// TOTP secrets are sealed with their own key derived from the flag key
+const (
+	sealedTOTPPrefix = "$totp$"
+	totpKeyPurpose   = "totp-secrets"
+)
+
+// EncryptTOTPSecret seals a TOTP secret in the form $totp$<kid>$<nonce+ciphertext>
+func EncryptTOTPSecret(secret string) (string, error) {
+	return sealValue(sealedTOTPPrefix, totpKeyPurpose, secret)
+}
+
+// DecryptTOTPSecret opens a sealed TOTP secret, including secrets sealed with
+// the flag key before they had their own key
+func DecryptTOTPSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, sealedTOTPPrefix):
+		return openValue(sealedTOTPPrefix, totpKeyPurpose, value)
+	case IsLegacyTOTPSecret(value):
+		return DecryptFlag(value)
+	default:
+		return "", errors.New("invalid TOTP secret format")
+	}
+}
+
+// IsLegacyTOTPSecret reports whether a TOTP secret is still sealed with the flag key
+func IsLegacyTOTPSecret(value string) bool {
+	return strings.HasPrefix(value, encryptedFlagPrefix)
+}